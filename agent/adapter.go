@@ -0,0 +1,453 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mikelsr/bspl/implementation"
+	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/reason"
+	"github.com/mikelsr/bspl/transport"
+)
+
+// Handler reacts to an action received by an Adapter
+type Handler func(e *Enactment) error
+
+// Enactment is the context of a received action
+type Enactment struct {
+	adapter *Adapter
+	// Instance after applying the received action, a snapshot that isn't
+	// updated by later actions
+	Instance reason.Instance
+	// Message that carried the action
+	Message reason.Message
+}
+
+// Send an action on the same instance, see Adapter.Send
+func (e *Enactment) Send(action string, values reason.Values) error {
+	return e.adapter.Send(e.Instance, action, values)
+}
+
+// Adapter plays a role in the protocols it knows. It receives messages
+// from a transport, keeps the instances in a reasoner up to date and
+// dispatches each action to the handler registered for it.
+type Adapter struct {
+	role      proto.Role
+	reasoner  reason.Reasoner
+	transport transport.Transport
+	// enactMu serializes the updates of the instances by Handle and Send,
+	// which read them before updating them
+	enactMu sync.Mutex
+
+	mu        sync.RWMutex
+	protocols map[string]proto.Protocol
+	handlers  map[string]Handler
+	onError   func(error)
+}
+
+// NewAdapter is the default constructor for Adapter.
+func NewAdapter(role proto.Role, r reason.Reasoner, t transport.Transport) *Adapter {
+	return &Adapter{
+		role:      role,
+		reasoner:  r,
+		transport: t,
+		protocols: make(map[string]proto.Protocol),
+		handlers:  make(map[string]Handler),
+		onError:   func(error) {},
+	}
+}
+
+// Role played by the Adapter
+func (a *Adapter) Role() proto.Role {
+	return a.role
+}
+
+// Register a protocol the Adapter can enact
+func (a *Adapter) Register(p proto.Protocol) error {
+	found := false
+	for _, r := range p.Roles {
+		found = found || r == a.role
+	}
+	if !found {
+		return fmt.Errorf("Role %s not in protocol '%s'", a.role, p.Name)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.protocols[p.Key()] = p
+	return nil
+}
+
+// OnReceive registers the handler called after receiving an action
+func (a *Adapter) OnReceive(action string, h Handler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.handlers[action] = h
+}
+
+// OnError registers the function called with the errors found by Run
+func (a *Adapter) OnError(f func(error)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.onError = f
+}
+
+// Run handles incoming messages until the transport is closed
+func (a *Adapter) Run() {
+	for m := range a.transport.Receive() {
+		if err := a.Handle(m); err != nil {
+			a.mu.RLock()
+			onError := a.onError
+			a.mu.RUnlock()
+			onError(err)
+		}
+	}
+}
+
+// Handle a message received from the transport: validate it, create
+// or update the instance it belongs to and call the action handler. The
+// handlers of parked messages enabled by the message are called too.
+// Instances are only created for applied messages of actions that bind
+// the keys of the protocol, with the roles carried by the message.
+func (a *Adapter) Handle(tm transport.Message) error {
+	var m reason.Message
+	if err := json.Unmarshal(tm.Payload, &m); err != nil {
+		return err
+	}
+	a.mu.RLock()
+	p, found := a.protocols[m.Protocol]
+	a.mu.RUnlock()
+	if !found {
+		return fmt.Errorf("Unknown protocol: '%s'", m.Protocol)
+	}
+	action, err := a.validate(p, m)
+	if err != nil {
+		return err
+	}
+	m.Action = action
+	applied, i, err := a.receive(p, m, tm.From)
+	if err != nil {
+		return err
+	}
+	for _, m := range applied {
+		a.mu.RLock()
+		h, found := a.handlers[m.Action.Name]
+		a.mu.RUnlock()
+		if !found {
+			continue
+		}
+		if err := h(&Enactment{adapter: a, Instance: i, Message: m}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receive applies a message to the instance it belongs to and returns the
+// messages applied and a snapshot of the instance after applying them
+func (a *Adapter) receive(p proto.Protocol, m reason.Message, from string) ([]reason.Message, reason.Instance, error) {
+	a.enactMu.Lock()
+	defer a.enactMu.Unlock()
+	i, created, err := a.instanceOf(p, m, from)
+	if err != nil {
+		return nil, nil, err
+	}
+	// messages that arrive before the ones they depend on are parked by
+	// the reasoner and applied once they are enabled
+	applied, err := a.reasoner.Receive(i.Key(), m)
+	if created && (err != nil || len(applied) == 0) {
+		// only messages that are applied start an enactment
+		a.reasoner.DropInstance(i.Key(), reason.MotiveRejected)
+		if err == nil {
+			err = fmt.Errorf("Action '%s' can't start an enactment of '%s'", m.Action, p.Name)
+		}
+	}
+	if err != nil || len(applied) == 0 {
+		return nil, nil, err
+	}
+	snapshot, found := a.reasoner.Snapshot(i.Key())
+	if !found {
+		return nil, nil, fmt.Errorf("Instance not found: '%s'", i.Key())
+	}
+	return applied, snapshot, nil
+}
+
+// Send an action on an instance. The values bind the 'out' parameters
+// of the action, its 'in' parameters are taken from the instance. Key
+// parameters bound when the instance was created may be outputs of the
+// action that starts the enactment. Actions with an extended key, see
+// proto.Protocol.ExtendedKey, run on the tuple identified by the values of
+// their key, which must be given even if they are 'in' parameters. The
+// action is checked against the instance held by the reasoner, i only
+// identifies it.
+func (a *Adapter) Send(i reason.Instance, actionName string, values reason.Values) error {
+	m, err := a.update(i.Key(), actionName, values)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	d := transport.NewDirectory(m.Roles)
+	return transport.SendTo(a.transport, d, m.Action.To, payload)
+}
+
+// update an instance with an action sent by the Adapter and return the
+// message carrying it
+func (a *Adapter) update(instanceKey string, actionName string, values reason.Values) (reason.Message, error) {
+	a.enactMu.Lock()
+	defer a.enactMu.Unlock()
+	i, found := a.reasoner.GetInstance(instanceKey)
+	if !found {
+		return reason.Message{}, fmt.Errorf("Instance not found: '%s'", instanceKey)
+	}
+	action, tuple, err := a.sendable(i, actionName, values)
+	if err != nil {
+		return reason.Message{}, err
+	}
+	m := reason.Message{
+		Protocol: i.Protocol().Key(),
+		Action:   action,
+		Roles:    i.Roles(),
+		Values:   make(reason.Values),
+	}
+	for _, param := range action.Ins() {
+		m.Values[param.Name] = tuple.value(param.Name)
+	}
+	for _, param := range action.Outs() {
+		m.Values[param.Name] = values[param.Name]
+	}
+	if tuple.key != nil {
+		outs := make(reason.Values)
+		for _, param := range action.Outs() {
+			outs[param.Name] = values[param.Name]
+		}
+		if err := a.reasoner.BindTuple(instanceKey, tuple.key, outs); err != nil {
+			return reason.Message{}, err
+		}
+	} else {
+		next, err := newVersion(i, m.Values)
+		if err != nil {
+			return reason.Message{}, err
+		}
+		if err := a.reasoner.UpdateInstance(next); err != nil {
+			return reason.Message{}, err
+		}
+	}
+	return m, nil
+}
+
+// tupleView of the bindings visible to an action: those of the tuple of
+// its extended key, if it has one, and those of the instance
+type tupleView struct {
+	i reason.Instance
+	// key of the tuple, nil for actions without an extended key
+	key   reason.Values
+	tuple reason.Values
+}
+
+func (v tupleView) value(param string) string {
+	if key, isKey := v.key[param]; isKey {
+		return key
+	}
+	return reason.TupleValue(v.i, v.tuple, param)
+}
+
+// bound returns true if a parameter is bound in the view, the keys of a
+// tuple are bound once the tuple exists
+func (v tupleView) bound(param string) bool {
+	if _, isKey := v.key[param]; isKey {
+		return v.tuple != nil
+	}
+	return v.value(param) != ""
+}
+
+// sendable finds the action the Adapter can send with the given values
+func (a *Adapter) sendable(i reason.Instance, actionName string, values reason.Values) (proto.Action, tupleView, error) {
+	keys := make(map[string]bool)
+	for _, k := range i.Protocol().Keys() {
+		keys[k.Name] = true
+	}
+	var err error
+ACTIONS:
+	for _, action := range i.Protocol().Actions {
+		if action.Name != actionName || action.From != a.role {
+			continue
+		}
+		v := tupleView{i: i}
+		expected := len(action.Outs())
+		if extended := i.Protocol().ExtendedKey(action); len(extended) > 0 {
+			ts, ok := i.(reason.TupleStore)
+			if !ok {
+				err = fmt.Errorf("Instance '%s' can't hold the tuples of action '%s'",
+					i.Key(), action)
+				continue
+			}
+			if v.key, err = reason.TupleKey(i.Protocol(), action, values); err != nil {
+				continue
+			}
+			v.tuple, _ = ts.Tuple(v.key)
+			for _, k := range extended {
+				if k.Io == proto.In {
+					expected++
+				}
+			}
+		}
+		if len(values) != expected {
+			err = fmt.Errorf("Action '%s' expects values for %d parameters, got %d",
+				action, expected, len(values))
+			continue
+		}
+		for _, param := range action.Params {
+			bound := v.bound(param.Name)
+			switch param.Io {
+			case proto.In:
+				if !bound {
+					err = fmt.Errorf("Action '%s' is not enabled: '%s' is unbound",
+						action, param.Name)
+					continue ACTIONS
+				}
+			case proto.Out:
+				value := values[param.Name]
+				if value == "" {
+					err = fmt.Errorf("Missing value for '%s'", param.Name)
+					continue ACTIONS
+				}
+				if err = i.Protocol().CheckValue(param.Name, value); err != nil {
+					continue ACTIONS
+				}
+				if bound && !(keys[param.Name] && v.value(param.Name) == value) {
+					err = fmt.Errorf("Action '%s' is not enabled: '%s' is bound",
+						action, param.Name)
+					continue ACTIONS
+				}
+			case proto.Nil:
+				if bound {
+					err = fmt.Errorf("Action '%s' is not enabled: '%s' is bound",
+						action, param.Name)
+					continue ACTIONS
+				}
+			}
+		}
+		return action, v, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("Role %s can't send action '%s'", a.role, actionName)
+	}
+	return proto.Action{}, tupleView{}, err
+}
+
+// validate that a message carries an action the Adapter can receive
+func (a *Adapter) validate(p proto.Protocol, m reason.Message) (proto.Action, error) {
+	var action proto.Action
+	found := false
+	for _, x := range p.Actions {
+		if x.String() == m.Action.String() {
+			action, found = x, true
+			break
+		}
+	}
+	if !found {
+		return action, fmt.Errorf("Unknown action: '%s'", m.Action)
+	}
+	if action.To != a.role {
+		return action, fmt.Errorf("Action '%s' is not for role %s", action, a.role)
+	}
+	expected := 0
+	for _, param := range action.Params {
+		if param.Io == proto.Nil {
+			continue
+		}
+		expected++
+		value := m.Values[param.Name]
+		if value == "" {
+			return action, fmt.Errorf("Missing value for '%s'", param.Name)
+		}
+		if err := p.CheckValue(param.Name, value); err != nil {
+			return action, err
+		}
+	}
+	if len(m.Values) != expected {
+		return action, fmt.Errorf("Action '%s' expects values for %d parameters, got %d",
+			action, expected, len(m.Values))
+	}
+	return action, nil
+}
+
+// instanceOf finds the instance a message sent by the given address
+// belongs to, which must play the role sending the action in it. If there
+// is none and the action starts an enactment, see starts, a new instance
+// is created with the roles carried by the message, binding its keys and
+// the 'in' parameters of the protocol carried by the message. It returns
+// true if the instance was created.
+func (a *Adapter) instanceOf(p proto.Protocol, m reason.Message, from string) (reason.Instance, bool, error) {
+	key := implementation.NewInstanceKey(p, m.Values)
+	if unbound := key.Unbound(); len(unbound) > 0 {
+		return nil, false, fmt.Errorf("Missing key values of '%s': %s",
+			p.Name, strings.Join(unbound, ", "))
+	}
+	if i, found := a.reasoner.GetInstance(key.String()); found {
+		if sender := i.Roles()[m.Action.From]; sender != from {
+			return nil, false, fmt.Errorf("Action '%s' sent by '%s' instead of '%s'",
+				m.Action, from, sender)
+		}
+		return i, false, nil
+	}
+	if !starts(p, m.Action) {
+		return nil, false, fmt.Errorf("Instance not found: '%s'", key)
+	}
+	if sender := m.Roles[m.Action.From]; sender != from {
+		return nil, false, fmt.Errorf("Action '%s' sent by '%s' instead of '%s'",
+			m.Action, from, sender)
+	}
+	if receiver := m.Roles[a.role]; receiver != a.transport.Addr() {
+		return nil, false, fmt.Errorf("Role %s assigned to '%s' instead of '%s'",
+			a.role, receiver, a.transport.Addr())
+	}
+	keys := make(reason.Values)
+	for _, k := range p.Keys() {
+		if k.Io != proto.In {
+			keys[k.Name] = m.Values[k.Name]
+		}
+	}
+	ins := make(reason.Values)
+	for _, in := range p.Ins() {
+		if v, found := m.Values[in.Name]; found {
+			ins[in.Name] = v
+		}
+	}
+	i, err := a.reasoner.Instantiate(p, m.Roles, keys, ins)
+	return i, err == nil, err
+}
+
+// starts returns true if an action can start an enactment of a protocol:
+// it binds every key of the protocol as an 'out' parameter
+func starts(p proto.Protocol, action proto.Action) bool {
+	outs := make(map[string]bool)
+	for _, param := range action.Outs() {
+		outs[param.Name] = true
+	}
+	for _, k := range p.Keys() {
+		if !outs[k.Name] {
+			return false
+		}
+	}
+	return true
+}
+
+// newVersion returns a copy of the keys of an instance with the given
+// values, which must belong to the types of their parameters
+func newVersion(i reason.Instance, values reason.Values) (reason.Instance, error) {
+	next := implementation.NewInstance(i.Protocol(), i.Roles())
+	for _, k := range i.Protocol().Keys() {
+		next.SetValue(k.Name, i.GetValue(k.Name))
+	}
+	for k, v := range values {
+		if err := next.SetValue(k, v); err != nil {
+			return nil, err
+		}
+	}
+	return next, nil
+}
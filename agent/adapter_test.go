@@ -0,0 +1,299 @@
+package agent
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mikelsr/bspl/implementation"
+	"github.com/mikelsr/bspl/parser"
+	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/reason"
+	"github.com/mikelsr/bspl/transport"
+)
+
+func testProtocol() proto.Protocol {
+	buyer := proto.Role("Buyer")
+	seller := proto.Role("Seller")
+	p := proto.Protocol{
+		Name:  "Purchase",
+		Roles: []proto.Role{buyer, seller},
+		Params: []proto.Parameter{
+			{Name: "ID", Key: true, Io: proto.Out},
+			{Name: "item", Io: proto.Out},
+			{Name: "price", Io: proto.Out},
+			{Name: "decision", Io: proto.Out},
+		},
+		Actions: []proto.Action{
+			{Name: "Request", From: buyer, To: seller, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.Out},
+				{Name: "item", Io: proto.Out},
+			}},
+			{Name: "Offer", From: seller, To: buyer, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "item", Io: proto.In},
+				{Name: "price", Io: proto.Out},
+			}},
+			{Name: "Accept", From: buyer, To: seller, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "price", Io: proto.In},
+				{Name: "decision", Io: proto.Out},
+			}},
+		},
+	}
+	p.Sort()
+	return p
+}
+
+func testAdapter(t *testing.T, n *transport.Network, role proto.Role, addr string) *Adapter {
+	tr, err := n.Listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAdapter(role, implementation.NewReasoner(implementation.SystemClock{}), tr)
+	if err := a.Register(testProtocol()); err != nil {
+		t.Fatal(err)
+	}
+	a.OnError(func(err error) { t.Error(err) })
+	return a
+}
+
+func TestAdapter(t *testing.T) {
+	p := testProtocol()
+	n := transport.NewNetwork()
+	buyer := testAdapter(t, n, "Buyer", "buyer")
+	seller := testAdapter(t, n, "Seller", "seller")
+	roles := reason.Roles{"Buyer": "buyer", "Seller": "seller"}
+
+	done := make(chan string, 1)
+	seller.OnReceive("Request", func(e *Enactment) error {
+		return e.Send("Offer", reason.Values{"price": "10"})
+	})
+	buyer.OnReceive("Offer", func(e *Enactment) error {
+		return e.Send("Accept", reason.Values{"decision": "yes"})
+	})
+	seller.OnReceive("Accept", func(e *Enactment) error {
+		done <- e.Instance.GetValue("decision")
+		return nil
+	})
+	go buyer.Run()
+	go seller.Run()
+
+	i, err := buyer.reasoner.Instantiate(p, roles, reason.Values{"ID": "1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := buyer.Send(i, "Offer", reason.Values{"price": "1"}); err == nil {
+		t.Fatal("Buyer sent Offer")
+	}
+	if err := buyer.Send(i, "Accept", reason.Values{"decision": "yes"}); err == nil {
+		t.Fatal("Sent disabled action")
+	}
+	if err := buyer.Send(i, "Request", reason.Values{"ID": "1"}); err == nil {
+		t.Fatal("Sent action with missing values")
+	}
+	if err := buyer.Send(i, "Request", reason.Values{"ID": "1", "item": "book"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case decision := <-done:
+		if decision != "yes" {
+			t.Fatalf("Unexpected decision: '%s'", decision)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the enactment")
+	}
+	if i.GetValue("price") != "10" {
+		t.Fatal("Buyer instance not updated")
+	}
+	if err := buyer.Register(proto.Protocol{Name: "Other", Roles: []proto.Role{"A"}}); err == nil {
+		t.Fatal("Registered protocol without the adapter role")
+	}
+}
+
+func TestAdapter_Handle(t *testing.T) {
+	n := transport.NewNetwork()
+	seller := testAdapter(t, n, "Seller", "seller")
+	roles := reason.Roles{"Buyer": "buyer", "Seller": "seller"}
+	p := testProtocol()
+	accept, request, offer := p.Actions[0], p.Actions[1], p.Actions[2]
+	messages := map[string]reason.Message{
+		"unknown protocol": {Protocol: "X", Action: request, Roles: roles,
+			Values: reason.Values{"ID": "1", "item": "book"}},
+		"missing value": {Protocol: p.Key(), Action: request, Roles: roles,
+			Values: reason.Values{"ID": "1"}},
+		"extra value": {Protocol: p.Key(), Action: request, Roles: roles,
+			Values: reason.Values{"ID": "1", "item": "book", "price": "1"}},
+		"wrong receiver": {Protocol: p.Key(), Action: offer, Roles: roles,
+			Values: reason.Values{"ID": "1", "item": "book", "price": "1"}},
+	}
+	for name, m := range messages {
+		if err := seller.Handle(testTransportMessage(t, "buyer", m)); err == nil {
+			t.Errorf("Handled invalid message: %s", name)
+		}
+	}
+	valid := reason.Message{Protocol: p.Key(), Action: request, Roles: roles,
+		Values: reason.Values{"ID": "1", "item": "book"}}
+	if err := seller.Handle(testTransportMessage(t, "mallory", valid)); err == nil {
+		t.Error("Handled message from the wrong sender")
+	}
+	orphan := reason.Message{Protocol: p.Key(), Action: accept, Roles: roles,
+		Values: reason.Values{"ID": "2", "price": "1", "decision": "yes"}}
+	if err := seller.Handle(testTransportMessage(t, "buyer", orphan)); err == nil {
+		t.Error("Handled message that can't start an enactment")
+	}
+	if len(seller.reasoner.Instances(p)) != 0 {
+		t.Fatal("Instance created for a rejected message")
+	}
+	if err := seller.Handle(testTransportMessage(t, "buyer", valid)); err != nil {
+		t.Fatal(err)
+	}
+	// the sender is checked against the roles of the instance
+	spoofed := reason.Message{Protocol: p.Key(), Action: accept,
+		Roles:  reason.Roles{"Buyer": "mallory", "Seller": "seller"},
+		Values: reason.Values{"ID": "1", "price": "1", "decision": "no"}}
+	if err := seller.Handle(testTransportMessage(t, "mallory", spoofed)); err == nil {
+		t.Error("Handled message from a sender naming itself in the roles")
+	}
+	// Accept is parked until the seller knows the price
+	handled := false
+	seller.OnReceive("Accept", func(*Enactment) error {
+		handled = true
+		return nil
+	})
+	early := reason.Message{Protocol: p.Key(), Action: accept, Roles: roles,
+		Values: reason.Values{"ID": "1", "price": "1", "decision": "yes"}}
+	if err := seller.Handle(testTransportMessage(t, "buyer", early)); err != nil {
+		t.Fatal(err)
+	}
+	i := implementation.NewInstance(p, roles)
+	i.SetValue("ID", "1")
+	if handled || len(seller.reasoner.Pending(i.Key())) != 1 {
+		t.Fatal("Expected Accept to be parked")
+	}
+}
+
+func TestAdapter_Tuples(t *testing.T) {
+	p, err := proto.NewBuilder("Order").
+		Roles("Buyer", "Seller").
+		Param(proto.OutParam("ID").AsKey(), proto.OutParam("itemNo"), proto.OutParam("item"),
+			proto.OutParam("shipped")).
+		Action("Buyer", "Seller", "AddItem", proto.OutParam("ID").AsKey(),
+			proto.OutParam("itemNo").AsKey(), proto.OutParam("item")).
+		Action("Seller", "Buyer", "Ship", proto.InParam("ID").AsKey(),
+			proto.InParam("itemNo").AsKey(), proto.InParam("item"), proto.OutParam("shipped")).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := transport.NewNetwork()
+	adapters := make(map[proto.Role]*Adapter)
+	for _, r := range p.Roles {
+		tr, err := n.Listen(string(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		adapters[r] = NewAdapter(r, implementation.NewReasoner(implementation.SystemClock{}), tr)
+		adapters[r].Register(p)
+		adapters[r].OnError(func(err error) { t.Error(err) })
+	}
+	buyer, seller := adapters["Buyer"], adapters["Seller"]
+	shipped := make(chan string, 2)
+	seller.OnReceive("AddItem", func(e *Enactment) error {
+		return e.Send("Ship", reason.Values{"itemNo": e.Message.Values["itemNo"], "shipped": "yes"})
+	})
+	buyer.OnReceive("Ship", func(e *Enactment) error {
+		shipped <- e.Message.Values["item"]
+		return nil
+	})
+	go buyer.Run()
+	go seller.Run()
+	roles := reason.Roles{"Buyer": "Buyer", "Seller": "Seller"}
+	i, err := buyer.reasoner.Instantiate(p, roles, reason.Values{"ID": "1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for no, item := range []string{"pen", "ink"} {
+		values := reason.Values{"ID": "1", "itemNo": string(rune('1' + no)), "item": item}
+		if err := buyer.Send(i, "AddItem", values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := buyer.Send(i, "AddItem", reason.Values{"ID": "1", "itemNo": "1", "item": "cap"}); err == nil {
+		t.Fatal("Sent an item twice")
+	}
+	for n := 0; n < 2; n++ {
+		select {
+		case <-shipped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the items")
+		}
+	}
+	tuples := i.(reason.TupleStore).Tuples([]string{"itemNo"})
+	if len(tuples) != 2 || tuples[0]["item"] != "pen" || tuples[0]["shipped"] != "yes" {
+		t.Fatalf("Unexpected tuples: %v", tuples)
+	}
+}
+
+func TestAdapter_Undeclared(t *testing.T) {
+	f, err := os.Open("../test/samples/example_1.bspl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, err := parser.Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := transport.NewNetwork()
+	adapters := make(map[proto.Role]*Adapter)
+	for _, r := range p.Roles {
+		tr, err := n.Listen(string(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		adapters[r] = NewAdapter(r, implementation.NewReasoner(implementation.SystemClock{}), tr)
+		if err := adapters[r].Register(p); err != nil {
+			t.Fatal(err)
+		}
+		adapters[r].OnError(func(err error) { t.Error(err) })
+	}
+	buyer, seller := adapters["Buyer"], adapters["Seller"]
+	// address and dropOff are not declared by the protocol
+	seller.OnReceive("Request", func(e *Enactment) error {
+		return e.Send("Offer", reason.Values{"price": "10"})
+	})
+	buyer.OnReceive("Offer", func(e *Enactment) error {
+		return e.Send("Accept", reason.Values{"decision": "yes", "address": "Main St"})
+	})
+	seller.OnReceive("Accept", func(e *Enactment) error {
+		return e.Send("Deliver", reason.Values{"dropOff": "door"})
+	})
+	buyer.OnReceive("Deliver", func(e *Enactment) error {
+		return e.Send("Payment", reason.Values{"OK": "paid"})
+	})
+	done := make(chan reason.Instance, 1)
+	seller.OnReceive("Payment", func(e *Enactment) error {
+		done <- e.Instance
+		return nil
+	})
+	go buyer.Run()
+	go seller.Run()
+	roles := reason.Roles{"Buyer": "Buyer", "Seller": "Seller"}
+	i, err := buyer.reasoner.Instantiate(p, roles, reason.Values{"ID": "1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := buyer.Send(i, "Request", reason.Values{"ID": "1", "item": "book"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case i := <-done:
+		if i.GetValue("address") != "Main St" || i.GetValue("dropOff") != "door" ||
+			!reason.Complete(i) {
+			t.Fatalf("Unexpected instance: %v", i.Parameters())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the payment")
+	}
+}
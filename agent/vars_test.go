@@ -0,0 +1,17 @@
+package agent
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mikelsr/bspl/reason"
+	"github.com/mikelsr/bspl/transport"
+)
+
+func testTransportMessage(t *testing.T, from string, m reason.Message) transport.Message {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transport.Message{From: from, Payload: payload}
+}
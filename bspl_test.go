@@ -1,8 +1,10 @@
 package bspl
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/mikelsr/bspl/parser"
@@ -35,3 +37,34 @@ func TestCompare(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestInterchange(t *testing.T) {
+	dir, err := parser.GetProjectDir()
+	if err != nil {
+		panic(err)
+	}
+	source, err := os.Open(filepath.Join(dir, "test", "samples", "example_1.bspl"))
+	if err != nil {
+		panic(err)
+	}
+	p, err := Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Protocol
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	// JSON -> text -> protocol is the original protocol
+	parsed, err := Parse(strings.NewReader(decoded.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Compare(p, decoded) || !Compare(p, parsed) {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+// genProtocol is the data fed to the template
+type genProtocol struct {
+	Package  string
+	Protocol proto.Protocol
+	Actions  []genAction
+	Roles    []genRole
+	// Types of the typed fields, with their helpers
+	Types []genType
+}
+
+// Imports returns true if a typed field uses the given package
+func (g genProtocol) Imports(pkg string) bool {
+	for _, t := range g.Types {
+		if strings.Contains(t.GoType, pkg+".") {
+			return true
+		}
+	}
+	return false
+}
+
+type genAction struct {
+	proto.Action
+	// Type is the name of the struct of the action
+	Type   string
+	Fields []genField
+}
+
+type genField struct {
+	proto.Parameter
+	Field string
+	Tag   string
+	// GoType of the field, string for untyped parameters
+	GoType string
+	// Value is the expression formatting the field of m
+	Value string
+	// Get is the expression reading the field from the instance i
+	Get string
+}
+
+// genType is a parameter type with a Go type other than string. Fields of
+// these types are pointers, nil if the parameter is unbound.
+type genType struct {
+	Type   proto.Type
+	Name   string
+	GoType string
+	// Ref and Deref convert the parsed values to and from the field type
+	Ref   string
+	Deref string
+}
+
+// genTypes by parameter type
+var genTypes = map[proto.Type]genType{
+	proto.Int:     {Type: proto.Int, Name: "Int", GoType: "*int64", Ref: "&", Deref: "*"},
+	proto.Decimal: {Type: proto.Decimal, Name: "Decimal", GoType: "*big.Rat"},
+	proto.Bool:    {Type: proto.Bool, Name: "Bool", GoType: "*bool", Ref: "&", Deref: "*"},
+	proto.Time:    {Type: proto.Time, Name: "Time", GoType: "*time.Time", Ref: "&", Deref: "*"},
+}
+
+type genRole struct {
+	Role     proto.Role
+	Receives []genAction
+}
+
+// Generate the Go source of the package of a protocol
+func Generate(p proto.Protocol, pkg string) ([]byte, error) {
+	if pkg == "" {
+		pkg = strings.ToLower(p.Name)
+	}
+	data := genProtocol{Package: pkg, Protocol: p}
+	keys := make(map[string]bool)
+	for _, k := range p.Keys() {
+		keys[k.Name] = true
+	}
+	types := make(map[string]bool)
+	used := make(map[proto.Type]bool)
+	for _, a := range p.Actions {
+		ga := genAction{Action: a, Type: exported(a.Name)}
+		// actions may share a name
+		for n := 2; types[ga.Type]; n++ {
+			ga.Type = fmt.Sprintf("%s%d", exported(a.Name), n)
+		}
+		types[ga.Type] = true
+		fields := make(map[string]bool)
+		for _, param := range a.Params {
+			if param.Io == proto.Nil {
+				continue
+			}
+			param.Key = keys[param.Name]
+			if declared, found := p.Param(param.Name); found {
+				param.Type = declared.Type
+			}
+			gf := genField{Parameter: param, Field: exported(param.Name), Tag: string(param.Io),
+				GoType: "string"}
+			gf.Value = "m." + gf.Field
+			gf.Get = fmt.Sprintf("i.GetValue(%q)", param.Name)
+			if t, typed := genTypes[param.Type]; typed {
+				used[param.Type] = true
+				gf.GoType = t.GoType
+				gf.Value = fmt.Sprintf("format%s(m.%s)", t.Name, gf.Field)
+				gf.Get = fmt.Sprintf("parse%s(i, %q)", t.Name, param.Name)
+			}
+			if param.Key {
+				gf.Tag += ",key"
+			}
+			if fields[gf.Field] {
+				return nil, fmt.Errorf("Parameters of '%s' map to the same field: %s", a.Name, gf.Field)
+			}
+			fields[gf.Field] = true
+			ga.Fields = append(ga.Fields, gf)
+		}
+		data.Actions = append(data.Actions, ga)
+	}
+	for _, t := range proto.Types {
+		if used[t] {
+			data.Types = append(data.Types, genTypes[t])
+		}
+	}
+	for _, r := range p.Roles {
+		gr := genRole{Role: r}
+		for _, ga := range data.Actions {
+			if ga.To == r {
+				gr.Receives = append(gr.Receives, ga)
+			}
+		}
+		data.Roles = append(data.Roles, gr)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// ioConst returns the proto constant of an IO
+func ioConst(io proto.IO) string {
+	switch io {
+	case proto.In:
+		return "proto.In"
+	case proto.Out:
+		return "proto.Out"
+	}
+	return "proto.Nil"
+}
+
+// typeConst returns the proto constant of a type
+func typeConst(t proto.Type) string {
+	if t == proto.Untyped {
+		return ""
+	}
+	return "proto." + exported(string(t))
+}
+
+// exported turns a BSPL name into an exported Go identifier
+func exported(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+var tmpl = template.Must(template.New("protocol").Funcs(template.FuncMap{
+	"ioConst":   ioConst,
+	"typeConst": typeConst,
+}).Parse(`// Code generated by bspl-gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"fmt"
+{{- if .Imports "big"}}
+	"math/big"
+{{- end}}
+{{- if .Imports "time"}}
+	"time"
+{{- end}}
+
+	"github.com/mikelsr/bspl/implementation"
+	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/reason"
+)
+
+// Protocol returns the {{.Protocol.Name}} protocol
+func Protocol() proto.Protocol {
+	return proto.Protocol{
+		Name:  {{printf "%q" .Protocol.Name}},
+		Roles: []proto.Role{ {{- range .Protocol.Roles}}{{printf "%q" .}}, {{end -}} },
+		Params: []proto.Parameter{
+		{{- range .Protocol.Params}}
+			{{template "param" .}},
+		{{- end}}
+		},
+		Actions: []proto.Action{
+		{{- range .Protocol.Actions}}
+			{Name: {{printf "%q" .Name}}, From: {{printf "%q" .From}}, To: {{printf "%q" .To}}, Params: []proto.Parameter{
+			{{- range .Params}}
+				{{template "param" .}},
+			{{- end}}
+			}},
+		{{- end}}
+		},
+		{{- if .Protocol.References}}
+		References: []proto.Reference{
+		{{- range .Protocol.References}}
+			{Name: {{printf "%q" .Name}}, Roles: []proto.Role{ {{- range .Roles}}{{printf "%q" .}}, {{end -}} }, Params: []proto.Parameter{
+			{{- range .Params}}
+				{{template "param" .}},
+			{{- end}}
+			}},
+		{{- end}}
+		},
+		{{- end}}
+	}
+}
+
+// bind checks that an action can be sent on an instance and binds its
+// 'out' parameters. The 'in' values, if given, must match the instance.
+// Key parameters bound when the instance was created may be outputs of
+// the action that starts the enactment. Values must belong to the types
+// of their parameters and are compared by type.
+func bind(i *implementation.Instance, action string, ins, outs, keys reason.Values) error {
+	equal := func(name, a, b string) bool {
+		param, _ := i.Protocol().Param(name)
+		return param.Type.Equal(a, b)
+	}
+	for name, value := range ins {
+		bound := i.GetValue(name)
+		if bound == "" {
+			return fmt.Errorf("Action '%s' is not enabled: '%s' is unbound", action, name)
+		}
+		if value != "" && !equal(name, value, bound) {
+			return fmt.Errorf("Action '%s' expected '%s' to be '%s', found '%s'",
+				action, name, bound, value)
+		}
+	}
+	for name, value := range outs {
+		if value == "" {
+			return fmt.Errorf("Missing value for '%s'", name)
+		}
+		if bound := i.GetValue(name); bound != "" && !(keys[name] != "" && equal(name, bound, value)) {
+			return fmt.Errorf("Action '%s' is not enabled: '%s' is bound", action, name)
+		}
+	}
+	for name, value := range outs {
+		if err := i.Protocol().CheckValue(name, value); err != nil {
+			return err
+		}
+	}
+	for name, value := range outs {
+		// keep the keys bound when the instance was created
+		if i.GetValue(name) == "" {
+			i.SetValue(name, value)
+		}
+	}
+	return nil
+}
+{{range .Types}}
+// format{{.Name}} formats the value of {{.Type}} fields, "" if it is nil
+func format{{.Name}}(v {{.GoType}}) string {
+	if v == nil {
+		return ""
+	}
+	return proto.Format{{.Name}}({{.Deref}}v)
+}
+
+// parse{{.Name}} reads the value of {{.Type}} parameters of an instance,
+// nil if it is unbound
+func parse{{.Name}}(i reason.Instance, name string) {{.GoType}} {
+	v, err := proto.Parse{{.Name}}(i.GetValue(name))
+	if err != nil {
+		return nil
+	}
+	return {{.Ref}}v
+}
+{{end}}
+{{- range .Actions}}
+// {{.Type}} is the action {{.Action}}
+type {{.Type}} struct {
+{{- range .Fields}}
+	{{.Field}} {{.GoType}} ` + "`" + `bspl:"{{.Tag}}"` + "`" + `
+{{- end}}
+}
+
+// Values returns the bindings of {{.Type}} by parameter name
+func (m {{.Type}}) Values() reason.Values {
+	return reason.Values{
+	{{- range .Fields}}
+		{{printf "%q" .Name}}: {{.Value}},
+	{{- end}}
+	}
+}
+
+// {{.Type}}From reads {{.Type}} from the bindings of an instance
+func {{.Type}}From(i reason.Instance) {{.Type}} {
+	return {{.Type}}{
+	{{- range .Fields}}
+		{{.Field}}: {{.Get}},
+	{{- end}}
+	}
+}
+
+// Send{{.Type}} binds the 'out' parameters of {{.Type}} on an instance
+// as {{.From}}. Its 'in' parameters must already be bound.
+func Send{{.Type}}(i *implementation.Instance, m {{.Type}}) error {
+	return bind(i, {{printf "%q" .Name}},
+		reason.Values{ {{- range .Fields}}{{if eq (print .Io) "in"}}{{printf "%q" .Name}}: {{.Value}}, {{end}}{{end -}} },
+		reason.Values{ {{- range .Fields}}{{if eq (print .Io) "out"}}{{printf "%q" .Name}}: {{.Value}}, {{end}}{{end -}} },
+		reason.Values{ {{- range .Fields}}{{if .Key}}{{printf "%q" .Name}}: {{.Value}}, {{end}}{{end -}} })
+}
+{{end}}
+{{- range .Roles}}
+// {{.Role}}Handler handles the actions received by {{.Role}}
+type {{.Role}}Handler interface {
+{{- range .Receives}}
+	// Handle{{.Type}} is called after receiving {{.Name}} from {{.From}}
+	Handle{{.Type}}(i *implementation.Instance, m {{.Type}}) error
+{{- end}}
+}
+
+// Dispatch{{.Role}} calls the method of the handler of a received action
+func Dispatch{{.Role}}(h {{.Role}}Handler, i *implementation.Instance, action proto.Action) error {
+	switch action.String() {
+{{- range .Receives}}
+	case {{printf "%q" .Action.String}}:
+		return h.Handle{{.Type}}(i, {{.Type}}From(i))
+{{- end}}
+	}
+	return fmt.Errorf("Role {{.Role}} doesn't receive action '%s'", action)
+}
+{{end}}
+{{- define "param"}}{Name: {{printf "%q" .Name}}, {{if .Key}}Key: true, {{end}}Io: {{ioConst .Io}}{{with typeConst .Type}}, Type: {{.}}{{end}}}{{end}}
+`))
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mikelsr/bspl"
+	"github.com/mikelsr/bspl/proto"
+)
+
+func testProtocol() proto.Protocol {
+	buyer := proto.Role("Buyer")
+	seller := proto.Role("Seller")
+	p := proto.Protocol{
+		Name:  "Purchase",
+		Roles: []proto.Role{buyer, seller},
+		Params: []proto.Parameter{
+			{Name: "ID", Key: true, Io: proto.Out},
+			{Name: "item", Io: proto.Out},
+			{Name: "price", Io: proto.Out},
+		},
+		Actions: []proto.Action{
+			{Name: "Request", From: buyer, To: seller, Params: []proto.Parameter{
+				{Name: "ID", Io: proto.Out},
+				{Name: "item", Io: proto.Out},
+			}},
+			{Name: "Offer", From: seller, To: buyer, Params: []proto.Parameter{
+				{Name: "ID", Io: proto.In},
+				{Name: "item", Io: proto.In},
+				{Name: "price", Io: proto.Out},
+			}},
+		},
+	}
+	p.Sort()
+	return p
+}
+
+// usage of the generated package, misuse would fail to compile
+const testUsage = `package purchase
+
+import (
+	"testing"
+
+	"github.com/mikelsr/bspl/implementation"
+	"github.com/mikelsr/bspl/proto"
+)
+
+type buyer struct{ offers int }
+
+func (b *buyer) HandleOffer(i *implementation.Instance, m Offer) error {
+	b.offers++
+	return nil
+}
+
+func TestGenerated(t *testing.T) {
+	p := Protocol()
+	i := implementation.NewInstance(p, implementation.Roles{"Buyer": "B", "Seller": "S"})
+	if err := SendOffer(i, Offer{Price: "10"}); err == nil {
+		t.Fatal("Sent disabled action")
+	}
+	if err := SendRequest(i, Request{ID: "1", Item: "book"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SendOffer(i, Offer{ID: "2", Price: "10"}); err == nil {
+		t.Fatal("Sent action with mismatched 'in' values")
+	}
+	if err := SendOffer(i, Offer{Price: "10"}); err != nil {
+		t.Fatal(err)
+	}
+	if OfferFrom(i) != (Offer{ID: "1", Item: "book", Price: "10"}) {
+		t.Fatal(OfferFrom(i))
+	}
+	b := new(buyer)
+	var offer proto.Action
+	for _, a := range p.Actions {
+		if a.Name == "Offer" {
+			offer = a
+		}
+	}
+	if err := DispatchBuyer(b, i, offer); err != nil || b.offers != 1 {
+		t.Fatal("Offer not dispatched")
+	}
+	if err := DispatchBuyer(b, i, p.Actions[0]); err == nil {
+		t.Fatal("Dispatched action not received by Buyer")
+	}
+}
+`
+
+func TestGenerate(t *testing.T) {
+	src, err := Generate(testProtocol(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"package purchase",
+		"type Request struct",
+		"ID   string `bspl:\"out,key\"`",
+		"type BuyerHandler interface",
+		"HandleOffer(i *implementation.Instance, m Offer) error",
+		"func SendRequest(i *implementation.Instance, m Request) error",
+	} {
+		if !bytes.Contains(src, []byte(expected)) {
+			t.Fatalf("Missing '%s' in:\n%s", expected, src)
+		}
+	}
+	// repeated action names produce different types
+	p := testProtocol()
+	p.Actions = append(p.Actions, p.Actions[0])
+	p.Actions[len(p.Actions)-1].From = "Seller"
+	p.Actions[len(p.Actions)-1].To = "Buyer"
+	if src, err = Generate(p, "x"); err != nil || !bytes.Contains(src, []byte("type Request2 struct")) {
+		t.Fatal("Repeated action names not handled")
+	}
+}
+
+// usage of the package generated for testdata/typed.bspl
+const testTypedUsage = `package purchase
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/mikelsr/bspl/implementation"
+)
+
+func TestGenerated(t *testing.T) {
+	i := implementation.NewInstance(Protocol(), implementation.Roles{"Buyer": "B", "Seller": "S"})
+	id := int64(1)
+	if err := SendRequest(i, Request{ID: &id, Item: "book"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SendOffer(i, Offer{Price: big.NewRat(21, 2)}); err != nil {
+		t.Fatal(err)
+	}
+	if i.GetValue("price") != "10.5" {
+		t.Fatal(i.GetValue("price"))
+	}
+	// bound values are compared by type
+	i.SetValue("price", "10.50")
+	paid, when := true, time.Date(2020, 4, 1, 10, 0, 0, 0, time.UTC)
+	if err := SendPay(i, Pay{Price: big.NewRat(1, 3), Paid: &paid, When: &when}); err == nil {
+		t.Fatal("Sent action with mismatched 'in' values")
+	}
+	if err := SendPay(i, Pay{Price: PayFrom(i).Price, Paid: &paid, When: &when}); err != nil {
+		t.Fatal(err)
+	}
+	m := PayFrom(i)
+	if *m.ID != 1 || m.Price.Cmp(big.NewRat(21, 2)) != 0 || !*m.Paid || !m.When.Equal(when) {
+		t.Fatal(m)
+	}
+	if OfferFrom(implementation.NewInstance(Protocol(), nil)).Price != nil {
+		t.Fatal("Unbound parameter read as a value")
+	}
+}
+`
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// readTestProtocol parses a protocol in testdata
+func readTestProtocol(t *testing.T, name string) proto.Protocol {
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, err := bspl.Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestGenerate_Typed(t *testing.T) {
+	src, err := Generate(readTestProtocol(t, "typed.bspl"), "purchase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "typed.golden")
+	if *update {
+		if err := ioutil.WriteFile(golden, src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, expected) {
+		t.Fatalf("Generated source differs from %s, run with -update to see the changes:\n%s",
+			golden, src)
+	}
+}
+
+// usage of the package generated for testdata/composite.bspl, the
+// expected hash is the one of the parsed protocol
+const testCompositeUsage = `package purchase
+
+import "testing"
+
+func TestGenerated(t *testing.T) {
+	p := Protocol()
+	if len(p.References) != 1 || p.References[0].Roles[0] != "Buyer" {
+		t.Fatal(p.References)
+	}
+	if p.Hash() != %q {
+		t.Fatal("Generated protocol differs from the parsed one")
+	}
+}
+`
+
+func TestGenerate_References(t *testing.T) {
+	p := readTestProtocol(t, "composite.bspl")
+	src, err := Generate(p, "purchase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{Name: "Payment", Roles: []proto.Role{"Buyer", "Seller"}, Params: []proto.Parameter{`
+	if !bytes.Contains(src, []byte(expected)) {
+		t.Fatalf("Missing '%s' in:\n%s", expected, src)
+	}
+	testCompiles(t, src, fmt.Sprintf(testCompositeUsage, p.Hash()))
+}
+
+func TestGenerate_Compiles(t *testing.T) {
+	src, err := Generate(testProtocol(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCompiles(t, src, testUsage)
+	if src, err = Generate(readTestProtocol(t, "typed.bspl"), "purchase"); err != nil {
+		t.Fatal(err)
+	}
+	testCompiles(t, src, testTypedUsage)
+}
+
+// testCompiles runs the tests in usage against a generated package
+func testCompiles(t *testing.T, src []byte, usage string) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	// the package must be inside the module to import it
+	dir, err := ioutil.TempDir(".", "gen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "purchase.go"), src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "purchase_test.go"), []byte(usage), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(goTool, "test", "./"+filepath.Base(dir)).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+}
+
+func TestRun(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	sample := filepath.Join("..", "..", "test", "samples", "example_1.bspl")
+	if code := run([]string{"-pkg", "sample", sample}, &stdout, &stderr); code != 0 {
+		t.Fatal(stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "// Code generated by bspl-gen. DO NOT EDIT.") {
+		t.Fatal(stdout.String())
+	}
+	if code := run(nil, &stdout, &stderr); code != 2 {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,66 @@
+// Command bspl-gen generates a Go package with typed messages for a BSPL
+// protocol.
+//
+// Usage:
+//
+//	bspl-gen [-pkg name] [-o file] <protocol.bspl>
+//
+// The package contains one struct per action with a field per parameter,
+// a pointer for parameters of types other than string such as *int64, a
+// handler interface per role with a method per received action and a
+// sender function per action that binds its values on an
+// implementation.Instance.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/mikelsr/bspl"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("bspl-gen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	pkg := fs.String("pkg", "", "package name, defaults to the protocol name in lower case")
+	out := fs.String("o", "", "output file, defaults to stdout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "Usage: bspl-gen [-pkg name] [-o file] <protocol.bspl>")
+		return 2
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer f.Close()
+	p, err := bspl.Parse(f)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", fs.Arg(0), err)
+		return 1
+	}
+	src, err := Generate(p, *pkg)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if *out == "" {
+		stdout.Write(src)
+		return 0
+	}
+	if err := ioutil.WriteFile(*out, src, 0644); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/mikelsr/bspl/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// readProtocol reads a protocol in BSPL, JSON or YAML depending on the
+// extension of the file. Decoded protocols are validated like parsed ones.
+func readProtocol(path string) (proto.Protocol, error) {
+	var p proto.Protocol
+	var unmarshal func([]byte, interface{}) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		unmarshal = json.Unmarshal
+	case ".yaml", ".yml":
+		unmarshal = yaml.Unmarshal
+	default:
+		return parseFile(path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return p, err
+	}
+	if err := unmarshal(data, &p); err != nil {
+		return p, err
+	}
+	return p, proto.Validate(p)
+}
+
+func runConvert(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("convert", stderr)
+	to := fs.String("to", "json", "output format: bspl, json or yaml")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "convert expects exactly one file")
+		return exitUsage
+	}
+	p, err := readProtocol(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", fs.Arg(0), err)
+		return exitError
+	}
+	switch *to {
+	case "bspl":
+		fmt.Fprintln(stdout, p.String())
+	case "json":
+		err = writeJSON(stdout, p)
+	case "yaml":
+		enc := yaml.NewEncoder(stdout)
+		enc.SetIndent(2)
+		err = enc.Encode(p)
+	default:
+		fmt.Fprintf(stderr, "Unknown format: %s\n", *to)
+		return exitUsage
+	}
+	return renderTo(stdout, stderr, err)
+}
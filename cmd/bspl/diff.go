@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+func runDiff(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("diff", stderr)
+	asJSON := fs.Bool("json", false, "print the changes as JSON")
+	role := fs.String("role", "", "only fail on changes breaking this role")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 2 {
+		fmt.Fprintln(stderr, "diff expects the old and the new protocol")
+		return exitUsage
+	}
+	var versions [2]proto.Protocol
+	for i, path := range fs.Args() {
+		p, err := readProtocol(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			return exitError
+		}
+		versions[i] = p
+	}
+	if *role != "" && !hasRole(versions[0], *role) && !hasRole(versions[1], *role) {
+		fmt.Fprintf(stderr, "Role %s not in either protocol\n", *role)
+		return exitUsage
+	}
+	changes := proto.Diff(versions[0], versions[1])
+	code := exitOK
+	if *role != "" && len(changes.For(proto.Role(*role))) > 0 || *role == "" && changes.Breaking() {
+		code = exitError
+	}
+	if *asJSON {
+		if err := writeJSON(stdout, changes); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		return code
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(stdout, "no changes")
+	}
+	for _, c := range changes {
+		fmt.Fprintln(stdout, c)
+	}
+	return code
+}
+
+// hasRole returns true if a protocol declares a role
+func hasRole(p proto.Protocol, role string) bool {
+	for _, r := range p.Roles {
+		if string(r) == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+func runFmt(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("fmt", stderr)
+	list := fs.Bool("l", false, "list files whose formatting differs")
+	write := fs.Bool("w", false, "write the result to the source files")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "fmt expects at least one file")
+		return exitUsage
+	}
+	code := exitOK
+	for _, path := range fs.Args() {
+		source, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			code = exitError
+			continue
+		}
+		p, err := parseFile(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			code = exitError
+			continue
+		}
+		formatted := p.String() + "\n"
+		changed := formatted != string(source)
+		if *list && changed {
+			fmt.Fprintln(stdout, path)
+		}
+		if *write && changed {
+			if err := ioutil.WriteFile(path, []byte(formatted), 0644); err != nil {
+				fmt.Fprintln(stderr, err)
+				code = exitError
+			}
+		}
+		if !*list && !*write {
+			fmt.Fprint(stdout, formatted)
+		}
+	}
+	return code
+}
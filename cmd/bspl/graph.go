@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mikelsr/bspl/render"
+)
+
+type edge struct {
+	Action    string   `json:"action"`
+	DependsOn string   `json:"depends_on"`
+	Params    []string `json:"params"`
+}
+
+func runGraph(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("graph", stderr)
+	asJSON := fs.Bool("json", false, "print the graph as JSON")
+	format := fs.String("format", "text", "output format: text, dot or mermaid")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *asJSON && *format != "text" {
+		fmt.Fprintln(stderr, "-json can't be used with -format")
+		return exitUsage
+	}
+	p, ok := parseOne(fs, stderr)
+	if !ok {
+		return exitError
+	}
+	switch *format {
+	case "text":
+	case "dot":
+		return renderTo(stdout, stderr, render.DOT(stdout, p))
+	case "mermaid":
+		return renderTo(stdout, stderr, render.MermaidFlowchart(stdout, p))
+	default:
+		fmt.Fprintf(stderr, "Unknown format: %s\n", *format)
+		return exitUsage
+	}
+	edges := make([]edge, 0)
+	for _, d := range p.Graph() {
+		e := edge{Action: d.Action.Name, DependsOn: d.DependsOn.Name}
+		for _, param := range d.Params {
+			e.Params = append(e.Params, param.Name)
+		}
+		edges = append(edges, e)
+	}
+	if *asJSON {
+		if err := writeJSON(stdout, edges); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		return exitOK
+	}
+	for _, e := range edges {
+		fmt.Fprintf(stdout, "%s -> %s [%s]\n", e.DependsOn, e.Action, strings.Join(e.Params, ", "))
+	}
+	return exitOK
+}
+
+func runSequence(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("sequence", stderr)
+	format := fs.String("format", "mermaid", "output format: mermaid or plantuml")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	p, ok := parseOne(fs, stderr)
+	if !ok {
+		return exitError
+	}
+	switch *format {
+	case "mermaid":
+		return renderTo(stdout, stderr, render.MermaidSequence(stdout, p))
+	case "plantuml":
+		return renderTo(stdout, stderr, render.PlantUMLSequence(stdout, p))
+	default:
+		fmt.Fprintf(stderr, "Unknown format: %s\n", *format)
+		return exitUsage
+	}
+}
+
+// renderTo reports the error of a renderer
+func renderTo(stdout, stderr io.Writer, err error) int {
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return exitOK
+}
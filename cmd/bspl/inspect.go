@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+type inspection struct {
+	Name   string      `json:"name"`
+	Key    string      `json:"key"`
+	Roles  []string    `json:"roles"`
+	Keys   []string    `json:"keys"`
+	Params []paramInfo `json:"parameters"`
+}
+
+type paramInfo struct {
+	Name      string   `json:"name"`
+	Io        string   `json:"io"`
+	Key       bool     `json:"key"`
+	Producers []string `json:"producers"`
+	Consumers []string `json:"consumers"`
+}
+
+func inspect(p proto.Protocol) inspection {
+	info := inspection{Name: p.Name, Key: p.Key(), Roles: []string{}, Keys: []string{}}
+	for _, r := range p.Roles {
+		info.Roles = append(info.Roles, string(r))
+	}
+	for _, k := range p.Keys() {
+		info.Keys = append(info.Keys, k.Name)
+	}
+	for _, param := range p.Params {
+		pi := paramInfo{
+			Name:      param.Name,
+			Io:        string(param.Io),
+			Key:       param.Key,
+			Producers: actionNames(p.Producers(param.Name)),
+			Consumers: actionNames(p.Consumers(param.Name)),
+		}
+		info.Params = append(info.Params, pi)
+	}
+	return info
+}
+
+func actionNames(acts []proto.Action) []string {
+	names := make([]string, 0, len(acts))
+	for _, a := range acts {
+		names = append(names, a.Name)
+	}
+	return names
+}
+
+func runInspect(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("inspect", stderr)
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	p, ok := parseOne(fs, stderr)
+	if !ok {
+		return exitError
+	}
+	info := inspect(p)
+	if *asJSON {
+		if err := writeJSON(stdout, info); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		return exitOK
+	}
+	fmt.Fprintf(stdout, "protocol: %s\n", info.Name)
+	fmt.Fprintf(stdout, "key: %s\n", info.Key)
+	fmt.Fprintf(stdout, "roles: %s\n", strings.Join(info.Roles, ", "))
+	fmt.Fprintf(stdout, "keys: %s\n", strings.Join(info.Keys, ", "))
+	fmt.Fprintln(stdout, "parameters:")
+	for _, pi := range info.Params {
+		fmt.Fprintf(stdout, "  %s %s\n", pi.Io, pi.Name)
+		fmt.Fprintf(stdout, "    producers: %s\n", strings.Join(pi.Producers, ", "))
+		fmt.Fprintf(stdout, "    consumers: %s\n", strings.Join(pi.Consumers, ", "))
+	}
+	return exitOK
+}
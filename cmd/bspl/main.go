@@ -0,0 +1,112 @@
+// Command bspl validates, formats, inspects and draws BSPL protocols.
+//
+// Usage:
+//
+//	bspl <command> [flags] <files...>
+//
+// The validate, diff, graph, inspect and simulate commands accept the -json flag to
+// produce machine-readable output.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/mikelsr/bspl"
+)
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// command run by the CLI, it returns the exit code
+type command struct {
+	usage string
+	run   func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands = map[string]command{
+	"convert":  {"convert [-to bspl|json|yaml] <file>: convert a protocol between BSPL, JSON and YAML", runConvert},
+	"diff":     {"diff [-json] [-role role] <old> <new>: print the changes between two versions, exit non-zero on breaking changes", runDiff},
+	"validate": {"validate [-json] [-strict] <files...>: check protocols, exit non-zero on errors", runValidate},
+	"fmt":      {"fmt [-l] [-w] <files...>: print protocols in canonical form", runFmt},
+	"graph":    {"graph [-json] [-format text|dot|mermaid] <file>: print the dependency graph of the actions", runGraph},
+	"inspect":  {"inspect [-json] <file>: print roles, keys, producers and consumers", runInspect},
+	"simulate": {"simulate [-json] [-mode random|bfs] [-seed n] [-runs n] [-steps n] [-traces] <file>: run enactments, exit non-zero on deadlocks or conflicts", runSimulate},
+	"sequence": {"sequence [-format mermaid|plantuml] <file>: print a sequence diagram of one enactment", runSequence},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	cmd, found := commands[args[0]]
+	if !found {
+		fmt.Fprintf(stderr, "Unknown command: %s\n", args[0])
+		usage(stderr)
+		return exitUsage
+	}
+	return cmd.run(args[1:], stdout, stderr)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: bspl <command> [flags] <files...>")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\n", commands[name].usage)
+	}
+}
+
+// newFlagSet creates the flag set of a command, errors are printed to stderr
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// parseFile parses the protocol in the file at path
+func parseFile(path string) (bspl.Protocol, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return bspl.Protocol{}, err
+	}
+	defer f.Close()
+	return bspl.Parse(f)
+}
+
+// parseOne parses the only file expected by a command
+func parseOne(fs *flag.FlagSet, stderr io.Writer) (bspl.Protocol, bool) {
+	if fs.NArg() != 1 {
+		fmt.Fprintf(stderr, "%s expects exactly one file\n", fs.Name())
+		return bspl.Protocol{}, false
+	}
+	p, err := parseFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", fs.Arg(0), err)
+		return p, false
+	}
+	return p, true
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/simulate"
+)
+
+var (
+	samples  = filepath.Join("..", "..", "test", "samples")
+	valid    = filepath.Join(samples, "example_1.bspl")
+	circular = filepath.Join(samples, "circular.bspl")
+)
+
+func runTest(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun(t *testing.T) {
+	if code, _, _ := runTest(); code != exitUsage {
+		t.FailNow()
+	}
+	if code, _, _ := runTest("unknown"); code != exitUsage {
+		t.FailNow()
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if code, out, _ := runTest("validate", valid); code != exitOK || !strings.Contains(out, "ok") ||
+		!strings.Contains(out, "warning: Parameter 'address' of action 'Accept' is not declared") {
+		t.Fatal(out)
+	}
+	code, out, _ := runTest("validate", "-json", valid, circular)
+	if code != exitError {
+		t.Fatal("Validated circular protocol")
+	}
+	var results []validation
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || !results[0].Valid || results[1].Valid || results[1].Error == "" {
+		t.Fatalf("Unexpected results: %v", results)
+	}
+	// address and dropOff are not declared by the protocol
+	if warnings := results[0].Warnings; len(warnings) != 4 ||
+		warnings[0].Code != proto.UndeclaredParam || warnings[0].Severity != proto.Warning {
+		t.Fatalf("Unexpected warnings: %v", warnings)
+	}
+	if issues := results[1].Issues; len(issues) != 1 || issues[0].Code != proto.Cycle {
+		t.Fatalf("Unexpected issues: %v", issues)
+	}
+	// address and dropOff are not declared by the protocol
+	code, out, _ = runTest("validate", "-strict", "-json", valid)
+	if code != exitError {
+		t.Fatal("Strict validation ignored undeclared parameters")
+	}
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range results[0].Issues {
+		if issue.Code != proto.UndeclaredParam {
+			t.Fatalf("Unexpected issue: %v", issue)
+		}
+	}
+}
+
+func TestFmt(t *testing.T) {
+	code, formatted, _ := runTest("fmt", valid)
+	if code != exitOK {
+		t.FailNow()
+	}
+	dir, err := ioutil.TempDir("", "bspl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "p.bspl")
+	source, _ := ioutil.ReadFile(valid)
+	if err := ioutil.WriteFile(path, source, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, out, _ := runTest("fmt", "-l", path); out != path+"\n" {
+		t.Fatalf("Unformatted file not listed: %s", out)
+	}
+	if code, _, _ := runTest("fmt", "-w", path); code != exitOK {
+		t.FailNow()
+	}
+	written, _ := ioutil.ReadFile(path)
+	if string(written) != formatted {
+		t.Fatal("Written file differs from the output of fmt")
+	}
+	if _, out, _ := runTest("fmt", "-l", path); out != "" {
+		t.Fatalf("Formatted file listed: %s", out)
+	}
+	// -l and -w list and write in the same pass
+	if err := ioutil.WriteFile(path, source, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code, out, _ := runTest("fmt", "-l", "-w", path); code != exitOK || out != path+"\n" {
+		t.Fatalf("Unformatted file not listed: %s", out)
+	}
+	if written, _ := ioutil.ReadFile(path); string(written) != formatted {
+		t.Fatal("Listed file not written")
+	}
+}
+
+func TestGraph(t *testing.T) {
+	code, out, _ := runTest("graph", valid)
+	if code != exitOK || !strings.Contains(out, "Request -> Offer [ID, item]") {
+		t.Fatal(out)
+	}
+	code, out, _ = runTest("graph", "-json", valid)
+	var edges []edge
+	if err := json.Unmarshal([]byte(out), &edges); err != nil || code != exitOK {
+		t.Fatal(err)
+	}
+	if len(edges) == 0 {
+		t.FailNow()
+	}
+	if code, out, _ := runTest("graph", "-format", "dot", valid); code != exitOK || !strings.HasPrefix(out, "digraph") {
+		t.Fatal(out)
+	}
+	if code, out, _ := runTest("graph", "-format", "mermaid", valid); code != exitOK || !strings.HasPrefix(out, "flowchart") {
+		t.Fatal(out)
+	}
+	if code, _, _ := runTest("graph", "-json", "-format", "dot", valid); code != exitUsage {
+		t.FailNow()
+	}
+	if code, _, _ := runTest("graph", valid, valid); code == exitOK {
+		t.Fatal("Accepted more than one file")
+	}
+}
+
+func TestInspect(t *testing.T) {
+	code, out, _ := runTest("inspect", "-json", valid)
+	if code != exitOK {
+		t.FailNow()
+	}
+	var info inspection
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Key != "Purchase,ID" || len(info.Roles) != 2 {
+		t.Fatalf("Unexpected inspection: %v", info)
+	}
+	for _, pi := range info.Params {
+		if pi.Name == "price" && (len(pi.Producers) != 1 || len(pi.Consumers) != 3) {
+			t.Fatalf("Unexpected producers and consumers of price: %v", pi)
+		}
+	}
+	if code, out, _ := runTest("inspect", valid); code != exitOK || !strings.Contains(out, "roles: Buyer, Seller") {
+		t.Fatal(out)
+	}
+}
+
+func TestSequence(t *testing.T) {
+	if code, out, _ := runTest("sequence", valid); code != exitOK || !strings.HasPrefix(out, "sequenceDiagram") {
+		t.Fatal(out)
+	}
+	if code, out, _ := runTest("sequence", "-format", "plantuml", valid); code != exitOK || !strings.HasPrefix(out, "@startuml") {
+		t.Fatal(out)
+	}
+	if code, _, _ := runTest("sequence", "-format", "svg", valid); code != exitUsage {
+		t.FailNow()
+	}
+}
+
+func TestConvert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bspl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	_, text, _ := runTest("fmt", valid)
+	for _, format := range []string{"json", "yaml"} {
+		code, out, errOut := runTest("convert", "-to", format, valid)
+		if code != exitOK {
+			t.Fatal(errOut)
+		}
+		path := filepath.Join(dir, "p."+format)
+		if err := ioutil.WriteFile(path, []byte(out), 0644); err != nil {
+			t.Fatal(err)
+		}
+		code, back, errOut := runTest("convert", "-to", "bspl", path)
+		if code != exitOK {
+			t.Fatal(errOut)
+		}
+		if back != text {
+			t.Fatalf("Converting from %s changed the protocol:\n%s", format, back)
+		}
+	}
+	if code, _, _ := runTest("convert", "-to", "xml", valid); code != exitUsage {
+		t.FailNow()
+	}
+	// decoded protocols are validated before converting them
+	for name, content := range map[string]string{
+		"empty.json":    "{}",
+		"noroles.json":  `{"name": "P"}`,
+		"noparams.yaml": "name: P\nroles: [A, B]\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if code, _, _ := runTest("convert", "-to", "bspl", path); code != exitError {
+			t.Fatalf("Converted invalid protocol %s", name)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	if code, out, _ := runTest("diff", valid, valid); code != exitOK || out != "no changes\n" {
+		t.Fatal(out)
+	}
+	dir, err := ioutil.TempDir("", "bspl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source, _ := ioutil.ReadFile(valid)
+	// the buyer must know the address before accepting
+	changed := strings.Replace(string(source), "out decision, out address]", "in address, out decision]", 1)
+	path := filepath.Join(dir, "p.bspl")
+	if err := ioutil.WriteFile(path, []byte(changed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	code, out, _ := runTest("diff", "-json", valid, path)
+	if code != exitError {
+		t.Fatal("Breaking change not reported")
+	}
+	var changes []proto.Change
+	if err := json.Unmarshal([]byte(out), &changes); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Impact["Buyer"] != proto.Breaking {
+		t.Fatalf("Unexpected changes: %v", changes)
+	}
+	if code, _, _ := runTest("diff", "-role", "Seller", valid, path); code != exitOK {
+		t.Fatal("Change breaks the seller")
+	}
+	if code, _, errOut := runTest("diff", "-role", "Shipper", valid, path); code != exitUsage ||
+		!strings.Contains(errOut, "Shipper") {
+		t.Fatalf("Unknown role accepted: %s", errOut)
+	}
+	if code, _, _ := runTest("diff", valid); code != exitUsage {
+		t.FailNow()
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	// accepting binds the undeclared address needed to deliver
+	code, out, _ := runTest("simulate", "-json", "-mode", "bfs", "-traces", valid)
+	if code != exitOK {
+		t.Fatal(out)
+	}
+	var r simulate.Report
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Runs != 2 || r.Completed != 2 || r.Deadlocks != 0 || len(r.Traces) != 2 {
+		t.Fatalf("Unexpected report: %+v", r)
+	}
+	code, out, _ = runTest("simulate", "-runs", "10", valid)
+	if code != exitOK || !strings.Contains(out, "runs: 10") {
+		t.Fatal(out)
+	}
+	dir, err := ioutil.TempDir("", "bspl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source, _ := ioutil.ReadFile(valid)
+	// nobody binds the receipt needed to pay
+	changed := strings.Replace(string(source), "in dropOff, out OK]", "in dropOff, in receipt, out OK]", 1)
+	path := filepath.Join(dir, "p.bspl")
+	if err := ioutil.WriteFile(path, []byte(changed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code, out, _ = runTest("simulate", "-mode", "bfs", path); code != exitError ||
+		!strings.Contains(out, "deadlocks: 1") {
+		t.Fatal(out)
+	}
+	if code, _, _ := runTest("simulate", "-mode", "dfs", valid); code != exitUsage {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mikelsr/bspl/simulate"
+)
+
+func runSimulate(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("simulate", stderr)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	mode := fs.String("mode", "random", "strategy: random or bfs")
+	seed := fs.Int64("seed", 1, "seed of the random strategy")
+	runs := fs.Int("runs", simulate.DefaultRuns, "enactments of the random strategy")
+	steps := fs.Int("steps", simulate.DefaultMaxSteps, "maximum steps of an enactment")
+	traces := fs.Bool("traces", false, "print the trace of each enactment")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	strategy := simulate.Strategy(*mode)
+	if strategy != simulate.Random && strategy != simulate.Exhaustive {
+		fmt.Fprintf(stderr, "Unknown mode: %s\n", *mode)
+		return exitUsage
+	}
+	p, ok := parseOne(fs, stderr)
+	if !ok {
+		return exitError
+	}
+	r, err := simulate.Run(p, simulate.Options{
+		Strategy: strategy,
+		Seed:     *seed,
+		Runs:     *runs,
+		MaxSteps: *steps,
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	code := exitOK
+	if r.Deadlocks > 0 || len(r.Conflicts) > 0 {
+		code = exitError
+	}
+	if !*traces {
+		r.Traces = nil
+	}
+	if *asJSON {
+		if err := writeJSON(stdout, r); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		return code
+	}
+	fmt.Fprintf(stdout, "protocol: %s\n", r.Protocol)
+	fmt.Fprintf(stdout, "strategy: %s\n", r.Strategy)
+	fmt.Fprintf(stdout, "runs: %d\n", r.Runs)
+	fmt.Fprintf(stdout, "completed: %d (%.0f%%)\n", r.Completed, 100*r.CompletionRate())
+	fmt.Fprintf(stdout, "deadlocks: %d\n", r.Deadlocks)
+	fmt.Fprintf(stdout, "truncated: %d\n", r.Truncated)
+	if r.Incomplete {
+		fmt.Fprintln(stdout, "exploration stopped before visiting every interleaving")
+	}
+	for _, c := range r.Conflicts {
+		fmt.Fprintf(stdout, "conflict: %s\n", c)
+	}
+	for n, t := range r.Traces {
+		fmt.Fprintf(stdout, "trace %d: %s\n", n+1, t.Outcome)
+		for _, s := range t.Steps {
+			fmt.Fprintf(stdout, "  %s\n", s)
+		}
+	}
+	return code
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+type validation struct {
+	File   string        `json:"file"`
+	Valid  bool          `json:"valid"`
+	Error  string        `json:"error,omitempty"`
+	Issues []proto.Issue `json:"issues,omitempty"`
+	// Warnings are the issues accepted without -strict
+	Warnings []proto.Issue `json:"warnings,omitempty"`
+}
+
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("validate", stderr)
+	asJSON := fs.Bool("json", false, "print the results as JSON")
+	strict := fs.Bool("strict", false, "check that actions agree with the parameters of the protocol")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "validate expects at least one file")
+		return exitUsage
+	}
+	code := exitOK
+	results := make([]validation, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		v := validation{File: path, Valid: true}
+		p, err := parseFile(path)
+		if err == nil && *strict {
+			err = proto.ValidateStrict(p)
+		} else if err == nil {
+			v.Warnings = proto.Warnings(p)
+		}
+		if err != nil {
+			v.Valid = false
+			v.Error = err.Error()
+			var ve proto.ValidationError
+			if errors.As(err, &ve) {
+				v.Issues = ve.Issues
+			}
+			code = exitError
+		}
+		results = append(results, v)
+	}
+	if *asJSON {
+		if err := writeJSON(stdout, results); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		return code
+	}
+	for _, v := range results {
+		if v.Valid {
+			fmt.Fprintf(stdout, "%s: ok\n", v.File)
+		} else {
+			fmt.Fprintf(stdout, "%s: %s\n", v.File, v.Error)
+		}
+		for _, w := range v.Warnings {
+			fmt.Fprintf(stdout, "%s: warning: %s\n", v.File, w)
+		}
+	}
+	return code
+}
@@ -2,4 +2,7 @@ module github.com/mikelsr/bspl
 
 go 1.14
 
-require bitbucket.org/mikelsr/gauzaez v1.0.0
+require (
+	bitbucket.org/mikelsr/gauzaez v1.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
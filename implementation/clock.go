@@ -0,0 +1,101 @@
+package implementation
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mikelsr/bspl/reason"
+)
+
+// SystemClock is a reason.Clock backed by the time package
+type SystemClock struct{}
+
+// Now returns the current local time.
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// AfterFunc calls f in its own goroutine after d has elapsed.
+func (SystemClock) AfterFunc(d time.Duration, f func()) reason.Timer {
+	return time.AfterFunc(d, f)
+}
+
+// FakeClock is a reason.Clock that only moves when told to. Scheduled
+// calls are run synchronously by Advance, which makes tests deterministic.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFakeClock is the default constructor for FakeClock.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc calls f once the clock has been advanced by d.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) reason.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, when: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward and runs, in order, every call
+// scheduled up to the new time.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	c.mu.Unlock()
+	for {
+		c.mu.Lock()
+		sort.SliceStable(c.timers, func(i, j int) bool {
+			return c.timers[i].when.Before(c.timers[j].when)
+		})
+		if len(c.timers) == 0 || c.timers[0].when.After(end) {
+			c.now = end
+			c.mu.Unlock()
+			return
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		c.mu.Unlock()
+		// run without holding the lock so f can schedule new calls
+		t.f()
+	}
+}
+
+// remove a timer from the clock, return false if it was not found
+func (c *FakeClock) remove(t *fakeTimer) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, x := range c.timers {
+		if x == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+	f     func()
+}
+
+func (t *fakeTimer) Stop() bool {
+	return t.clock.remove(t)
+}
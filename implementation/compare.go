@@ -0,0 +1,226 @@
+package implementation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/reason"
+)
+
+// ProtocolChange between two instances whose protocols have different
+// content hashes
+type ProtocolChange struct {
+	OldKey  string `json:"old_key"`
+	NewKey  string `json:"new_key"`
+	OldHash string `json:"old_hash"`
+	NewHash string `json:"new_hash"`
+}
+
+// RoleChange of the agent playing a role, empty if the role is not
+// assigned
+type RoleChange struct {
+	Role proto.Role `json:"role"`
+	Old  string     `json:"old"`
+	New  string     `json:"new"`
+}
+
+// ValueChange of a parameter, empty if the parameter is not bound
+type ValueChange struct {
+	Param string `json:"parameter"`
+	// Tuple is the key of the tuple of the parameter, nil for the
+	// parameters of the instance
+	Tuple Values `json:"tuple,omitempty"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+func (c ValueChange) String() string {
+	param := c.Param
+	if len(c.Tuple) > 0 {
+		_, id := tupleID(c.Tuple)
+		param = fmt.Sprintf("%s[%s]", c.Param, id)
+	}
+	return fmt.Sprintf("%s: '%s' -> '%s'", param, c.Old, c.New)
+}
+
+// Difference between two instances, see Instance.Compare
+type Difference struct {
+	Protocol *ProtocolChange `json:"protocol,omitempty"`
+	Roles    []RoleChange    `json:"roles,omitempty"`
+	Values   []ValueChange   `json:"values,omitempty"`
+}
+
+// Empty returns true if the instances are equal
+func (d Difference) Empty() bool {
+	return d.Protocol == nil && len(d.Roles) == 0 && len(d.Values) == 0
+}
+
+func (d Difference) String() string {
+	lines := make([]string, 0)
+	if d.Protocol != nil {
+		lines = append(lines, fmt.Sprintf("protocol: %s (%s) -> %s (%s)", d.Protocol.OldKey,
+			d.Protocol.OldHash, d.Protocol.NewKey, d.Protocol.NewHash))
+	}
+	for _, c := range d.Roles {
+		lines = append(lines, fmt.Sprintf("role %s: '%s' -> '%s'", c.Role, c.Old, c.New))
+	}
+	for _, c := range d.Values {
+		lines = append(lines, c.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Compare an instance with another one. It returns the differences in
+// the content hash of their protocols, their role bindings and their
+// values by parameter name, including the tuples of other Instances,
+// sorted by role and parameter.
+func (i *Instance) Compare(j reason.Instance) Difference {
+	return i.compare(j, true)
+}
+
+// Equals compares two instances: they are equal if their protocols have
+// the same content hash and they have the same roles and values, see
+// Compare. It stops at the first difference.
+func (i *Instance) Equals(j reason.Instance) bool {
+	return i.compare(j, false).Empty()
+}
+
+// compare returns every difference with another instance, or only the
+// first one
+func (i *Instance) compare(j reason.Instance, all bool) Difference {
+	var d Difference
+	if old, new := i.protocolHash(), hashOf(j); old != new {
+		d.Protocol = &ProtocolChange{OldKey: i.protocol.Key(), NewKey: j.Protocol().Key(),
+			OldHash: old, NewHash: new}
+		if !all {
+			return d
+		}
+	}
+	roles := make(map[proto.Role]bool)
+	for r := range i.Roles() {
+		roles[r] = true
+	}
+	for r := range j.Roles() {
+		roles[r] = true
+	}
+	sorted := make([]proto.Role, 0, len(roles))
+	for r := range roles {
+		sorted = append(sorted, r)
+	}
+	proto.SortRoles(sorted)
+	for _, r := range sorted {
+		if old, new := i.Roles()[r], j.Roles()[r]; old != new {
+			d.Roles = append(d.Roles, RoleChange{Role: r, Old: old, New: new})
+			if !all {
+				return d
+			}
+		}
+	}
+	d.Values = compareValues(nil, valuesByName(i), valuesByName(j), all)
+	if !all && len(d.Values) > 0 {
+		return d
+	}
+	if other, ok := j.(*Instance); ok {
+		d.Values = append(d.Values, compareTuples(i.tuples, other.tuples, all)...)
+	}
+	return d
+}
+
+// hashOf returns the content hash of the protocol of an instance, cached
+// for Instances
+func hashOf(i reason.Instance) string {
+	if x, ok := i.(*Instance); ok {
+		return x.protocolHash()
+	}
+	return i.Protocol().Hash()
+}
+
+// valuesByName returns the bound parameters of an instance by name
+func valuesByName(i reason.Instance) Values {
+	values := make(Values)
+	for _, param := range i.Protocol().Parameters() {
+		if v := i.GetValue(param.Name); v != "" {
+			values[param.Name] = v
+		}
+	}
+	for _, name := range i.Protocol().Undeclared() {
+		if v := i.GetValue(name); v != "" {
+			values[name] = v
+		}
+	}
+	return values
+}
+
+// compareValues returns the changes from old to new, or only the first one
+func compareValues(tuple Values, old, new Values, all bool) []ValueChange {
+	names := make([]string, 0, len(old)+len(new))
+	for name := range old {
+		names = append(names, name)
+	}
+	for name := range new {
+		if _, found := old[name]; !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	changes := make([]ValueChange, 0)
+	for _, name := range names {
+		if old[name] != new[name] {
+			changes = append(changes, ValueChange{Param: name, Tuple: tuple,
+				Old: old[name], New: new[name]})
+			if !all {
+				break
+			}
+		}
+	}
+	return changes
+}
+
+// compareTuples returns the changes from the old tuples to the new ones,
+// or only the first one
+func compareTuples(old, new tuples, all bool) []ValueChange {
+	// tuples by signature and id
+	ids := make(map[[2]string]bool)
+	for _, ts := range []tuples{old, new} {
+		for signature, byID := range ts {
+			for id := range byID {
+				ids[[2]string{signature, id}] = true
+			}
+		}
+	}
+	sorted := make([][2]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Slice(sorted, func(x, y int) bool {
+		if sorted[x][0] != sorted[y][0] {
+			return sorted[x][0] < sorted[y][0]
+		}
+		return sorted[x][1] < sorted[y][1]
+	})
+	changes := make([]ValueChange, 0)
+	for _, id := range sorted {
+		o, n := old[id[0]][id[1]], new[id[0]][id[1]]
+		changes = append(changes, compareValues(tupleKey(id[0], id[1]), o, n, all)...)
+		if !all && len(changes) > 0 {
+			break
+		}
+	}
+	return changes
+}
+
+// tupleKey decodes the key of a tuple from the names of its extended key
+// and its id, see tupleID
+func tupleKey(signature string, id string) Values {
+	names, _ := splitKey(signature, proto.KeySeparator)
+	values, _ := splitKey(id, proto.KeySeparator)
+	key := make(Values, len(names))
+	for n, name := range names {
+		if n < len(values) {
+			key[unescapeKey(name)] = unescapeKey(values[n])
+		}
+	}
+	return key
+}
@@ -0,0 +1,87 @@
+package implementation
+
+import (
+	"testing"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+func TestInstance_Compare(t *testing.T) {
+	i1 := testInstance()
+	i2 := testInstance()
+	if d := i1.Compare(i2); !d.Empty() {
+		t.Fatalf("Expected no differences, found:\n%s", d)
+	}
+	// roles used to be compared with themselves
+	i2.roles = Roles{proto.Role("Buyer"): "B", proto.Role("Seller"): "T"}
+	if i1.Equals(i2) {
+		t.Fatal("Instances with different roles are equal")
+	}
+	d := i1.Compare(i2)
+	if len(d.Roles) != 1 || d.Roles[0].Role != "Seller" || d.Roles[0].Old != "S" ||
+		d.Roles[0].New != "T" {
+		t.Fatalf("Wrong role changes: %v", d.Roles)
+	}
+	if d.Protocol != nil || len(d.Values) != 0 {
+		t.Fatalf("Unexpected differences:\n%s", d)
+	}
+
+	i3 := testInstance()
+	i3.SetValue("price", "Y")
+	i3.values["out item"] = ""
+	d = i1.Compare(i3)
+	if len(d.Values) != 2 {
+		t.Fatalf("Wrong value changes: %v", d.Values)
+	}
+	if c := d.Values[0]; c.Param != "item" || c.Old != "X" || c.New != "" {
+		t.Fatalf("Wrong value change: %v", c)
+	}
+	if c := d.Values[1]; c.Param != "price" || c.Old != "X" || c.New != "Y" {
+		t.Fatalf("Wrong value change: %v", c)
+	}
+}
+
+func TestInstance_CompareProtocol(t *testing.T) {
+	i1 := testInstance()
+	// same name and keys, different body
+	p := testProtocol()
+	p.Actions = p.Actions[1:]
+	i2 := NewInstance(p, i1.Roles())
+	i2.values = i1.values
+	if i1.Key() != i2.Key() {
+		t.Fatal("Expected the same key")
+	}
+	d := i1.Compare(i2)
+	if d.Protocol == nil || d.Protocol.OldHash == d.Protocol.NewHash {
+		t.Fatalf("Expected a protocol mismatch, found:\n%s", d)
+	}
+	if i1.Equals(i2) {
+		t.Fatal("Instances of different protocols are equal")
+	}
+}
+
+func TestInstance_CompareTuples(t *testing.T) {
+	p := orderProtocol()
+	roles := Roles{proto.Role("Buyer"): "B", proto.Role("Seller"): "S"}
+	i1 := NewInstance(p, roles)
+	i1.SetValue("ID", "1")
+	i2 := NewInstance(p, roles)
+	i2.SetValue("ID", "1")
+	if err := i1.BindTuple(Values{"itemNo": "1"}, Values{"item": "ball"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := i2.BindTuple(Values{"itemNo": "1"}, Values{"item": "bat"}); err != nil {
+		t.Fatal(err)
+	}
+	if i1.Equals(i2) {
+		t.Fatal("Instances with different tuples are equal")
+	}
+	d := i1.Compare(i2)
+	if len(d.Values) != 1 {
+		t.Fatalf("Wrong value changes: %v", d.Values)
+	}
+	c := d.Values[0]
+	if c.Param != "item" || c.Tuple["itemNo"] != "1" || c.Old != "ball" || c.New != "bat" {
+		t.Fatalf("Wrong value change: %v", c)
+	}
+}
@@ -0,0 +1,170 @@
+package implementation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+func testComposite() (proto.Protocol, proto.Protocol) {
+	payment := proto.Protocol{
+		Name:  "Payment",
+		Roles: []proto.Role{"Payer", "Payee"},
+		Params: []proto.Parameter{
+			{Name: "ID", Key: true, Io: proto.In},
+			{Name: "price", Io: proto.In},
+			{Name: "receipt", Io: proto.Out},
+		},
+		Actions: []proto.Action{
+			{Name: "Pay", From: "Payer", To: "Payee", Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "price", Io: proto.In},
+				{Name: "receipt", Io: proto.Out},
+			}},
+		},
+	}
+	p := testProtocol()
+	p.Params = append(p.Params, proto.Parameter{Name: "receipt", Io: proto.Out})
+	// the buyer pays the seller
+	p.References = []proto.Reference{{Name: "Payment", Roles: []proto.Role{"Buyer", "Seller"},
+		Params: []proto.Parameter{
+			{Name: "ID", Key: true, Io: proto.In},
+			{Name: "price", Io: proto.In},
+			{Name: "receipt", Io: proto.Out},
+		}}}
+	return p, payment
+}
+
+func TestReasoner_Spawn(t *testing.T) {
+	r := NewReasoner(NewFakeClock(time.Unix(0, 0)))
+	p, payment := testComposite()
+	parent, err := r.Instantiate(p, testRoles(), Values{"ID": "X"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Spawn(parent.Key(), payment); err == nil {
+		t.Fatal("Spawned child without inputs")
+	}
+	parent.SetValue("item", "I")
+	parent.SetValue("price", "10")
+	if _, err := r.Spawn(parent.Key(), testProtocol()); err == nil {
+		t.Fatal("Spawned unreferenced protocol")
+	}
+	child, err := r.Spawn(parent.Key(), payment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if child.Parent() != parent.Key() || len(parent.Children()) != 1 || parent.Children()[0] != child.Key() {
+		t.Fatal("Instances not linked")
+	}
+	if child.Roles()["Payer"] != "B" || child.Roles()["Payee"] != "S" || child.GetValue("price") != "10" {
+		t.Fatal("Bindings not taken from the parent")
+	}
+	// the outputs of the child flow back on completion
+	next := NewInstance(payment, child.Roles())
+	for k, v := range map[string]string{"ID": "X", "price": "10", "receipt": "R"} {
+		next.SetValue(k, v)
+	}
+	if err := r.UpdateInstance(next); err != nil {
+		t.Fatal(err)
+	}
+	if parent.GetValue("receipt") != "R" {
+		t.Fatal("Output not bound in the parent")
+	}
+	// children are dropped with their parents
+	if err := r.DropInstance(parent.Key(), "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := r.GetInstance(child.Key()); found {
+		t.Fatal("Child not dropped")
+	}
+}
+
+func TestInstance_MarshalLinks(t *testing.T) {
+	p, payment := testComposite()
+	child, _ := Instantiate(payment, Roles{"Payer": "B", "Payee": "S"}, nil, Values{"ID": "X", "price": "1"})
+	child.parent = "parent"
+	parent := NewInstance(p, testRoles())
+	parent.AddChild(child.Key())
+	parent.AddChild(child.Key())
+	for _, i := range []*Instance{child, parent} {
+		data, err := i.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := new(Instance)
+		if err := decoded.Unmarshal(data); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Parent() != i.Parent() || len(decoded.Children()) != len(i.Children()) {
+			t.Fatal("Links not marshalled")
+		}
+	}
+	if len(parent.Children()) != 1 {
+		t.Fatal("Repeated child")
+	}
+}
+
+func TestReasoner_SpawnNested(t *testing.T) {
+	r := NewReasoner(NewFakeClock(time.Unix(0, 0)))
+	p, payment := testComposite()
+	// the buyer settles the purchase by paying
+	settlement := proto.Protocol{
+		Name:   "Settlement",
+		Roles:  []proto.Role{"Payee", "Payer"},
+		Params: payment.Params,
+		References: []proto.Reference{{Name: "Payment", Roles: []proto.Role{"Payee", "Payer"},
+			Params: payment.Params}},
+	}
+	p.References[0].Name = "Settlement"
+	parent, _ := r.Instantiate(p, testRoles(), Values{"ID": "X"}, nil)
+	parent.SetValue("item", "I")
+	parent.SetValue("price", "10")
+	middle, err := r.Spawn(parent.Key(), settlement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := r.Spawn(middle.Key(), payment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := NewInstance(payment, child.Roles())
+	for k, v := range map[string]string{"ID": "X", "price": "10", "receipt": "R"} {
+		next.SetValue(k, v)
+	}
+	if err := r.UpdateInstance(next); err != nil {
+		t.Fatal(err)
+	}
+	if middle.GetValue("receipt") != "R" || parent.GetValue("receipt") != "R" {
+		t.Fatal("Completion not propagated")
+	}
+}
+
+func TestReasoner_CompleteConflict(t *testing.T) {
+	r := NewReasoner(NewFakeClock(time.Unix(0, 0)))
+	p, payment := testComposite()
+	// the payment outputs a receipt and a fee
+	fee := proto.Parameter{Name: "fee", Io: proto.Out}
+	payment.Params = append(payment.Params, fee)
+	p.Params = append(p.Params, fee)
+	p.References[0].Params = append(p.References[0].Params, fee)
+	parent, _ := r.Instantiate(p, testRoles(), Values{"ID": "X"}, nil)
+	parent.SetValue("item", "I")
+	parent.SetValue("price", "10")
+	child, err := r.Spawn(parent.Key(), payment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent.SetValue("fee", "1")
+	next := NewInstance(payment, child.Roles())
+	for k, v := range map[string]string{"ID": "X", "price": "10", "receipt": "R", "fee": "2"} {
+		next.SetValue(k, v)
+	}
+	if err := r.UpdateInstance(next); err == nil {
+		t.Fatal("Contradicting output bound in the parent")
+	}
+	if parent.GetValue("receipt") != "" || parent.GetValue("fee") != "1" {
+		t.Fatal("Parent partially updated")
+	}
+}
@@ -0,0 +1,171 @@
+package implementation
+
+import (
+	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/reason"
+)
+
+// keySet is a set of instance keys
+type keySet map[string]struct{}
+
+// index keeps the instances of a protocol by parameter binding so
+// reason.Condition queries don't have to look at every instance
+type index struct {
+	protocol proto.Protocol
+	// all the instance keys of the protocol
+	all keySet
+	// bindings of each instance at the time it was indexed
+	bindings map[string]Values
+	// bound maps parameter names to values to instance keys
+	bound map[string]map[string]keySet
+	// unbound maps parameter names to the instances that lack them
+	unbound map[string]keySet
+}
+
+func newIndex(p proto.Protocol) *index {
+	x := &index{
+		protocol: p,
+		all:      make(keySet),
+		bindings: make(map[string]Values),
+		bound:    make(map[string]map[string]keySet),
+		unbound:  make(map[string]keySet),
+	}
+	for _, param := range p.Params {
+		x.bound[param.Name] = make(map[string]keySet)
+		x.unbound[param.Name] = make(keySet)
+	}
+	return x
+}
+
+// add or re-index an instance
+func (x *index) add(i reason.Instance) {
+	key := i.Key()
+	x.remove(key)
+	x.all[key] = struct{}{}
+	bindings := make(Values)
+	for param := range x.bound {
+		value := i.GetValue(param)
+		if value == "" {
+			x.unbound[param][key] = struct{}{}
+			continue
+		}
+		bindings[param] = value
+		keys, found := x.bound[param][value]
+		if !found {
+			keys = make(keySet)
+			x.bound[param][value] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	x.bindings[key] = bindings
+}
+
+// remove an instance from the index
+func (x *index) remove(key string) {
+	bindings, found := x.bindings[key]
+	if !found {
+		return
+	}
+	for param := range x.bound {
+		value, found := bindings[param]
+		if !found {
+			delete(x.unbound[param], key)
+			continue
+		}
+		keys := x.bound[param][value]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(x.bound[param], value)
+		}
+	}
+	delete(x.bindings, key)
+	delete(x.all, key)
+}
+
+// query returns the keys of the instances matching every condition
+func (x *index) query(conditions ...reason.Condition) keySet {
+	result := x.all
+	for _, c := range conditions {
+		result = intersect(result, x.match(c))
+		if len(result) == 0 {
+			break
+		}
+	}
+	return result
+}
+
+// match returns the keys of the instances matching a condition
+func (x *index) match(c reason.Condition) keySet {
+	switch c.Kind {
+	case reason.ParamEquals:
+		if values, found := x.bound[c.Param]; found {
+			return values[c.Value]
+		}
+	case reason.ParamUnbound:
+		return x.unboundKeys(c.Param)
+	case reason.ActionEnabled:
+		matches := make(keySet)
+		for _, a := range x.protocol.Actions {
+			if a.Name == c.Action && a.From == c.Role {
+				matches = union(matches, x.enabled(a))
+			}
+		}
+		return matches
+	}
+	return keySet{}
+}
+
+// enabled returns the instances where an action can be run
+func (x *index) enabled(a proto.Action) keySet {
+	result := x.all
+	for _, param := range a.Params {
+		if param.Io == proto.In {
+			result = difference(result, x.unboundKeys(param.Name))
+		} else {
+			result = intersect(result, x.unboundKeys(param.Name))
+		}
+	}
+	return result
+}
+
+// unboundKeys returns the instances lacking a parameter. Parameters
+// not declared by the protocol can't be bound.
+func (x *index) unboundKeys(param string) keySet {
+	if keys, found := x.unbound[param]; found {
+		return keys
+	}
+	return x.all
+}
+
+func intersect(a, b keySet) keySet {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	result := make(keySet)
+	for k := range a {
+		if _, found := b[k]; found {
+			result[k] = struct{}{}
+		}
+	}
+	return result
+}
+
+func union(a, b keySet) keySet {
+	result := make(keySet)
+	for _, s := range []keySet{a, b} {
+		for k := range s {
+			result[k] = struct{}{}
+		}
+	}
+	return result
+}
+
+func difference(a, b keySet) keySet {
+	result := make(keySet)
+	for k := range a {
+		if _, found := b[k]; !found {
+			result[k] = struct{}{}
+		}
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package implementation
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mikelsr/bspl/reason"
+)
+
+func TestReasoner_Query(t *testing.T) {
+	r := NewReasoner(NewFakeClock(time.Unix(0, 0)))
+	p := testProtocol()
+	// 0: nothing, 1: Request, 2: Request and Offer
+	var last reason.Instance
+	for n := 0; n < 30; n++ {
+		id := fmt.Sprint(n)
+		i, err := r.Instantiate(p, testRoles(), Values{"ID": id}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = i
+		if n%3 == 0 {
+			continue
+		}
+		next := NewInstance(p, testRoles())
+		next.SetValue("ID", id)
+		next.SetValue("item", fmt.Sprint("item", n%2))
+		if err := r.UpdateInstance(next); err != nil {
+			t.Fatal(err)
+		}
+		if n%3 == 1 {
+			continue
+		}
+		next = NewInstance(p, testRoles())
+		next.SetValue("ID", id)
+		next.SetValue("price", "10")
+		if err := r.UpdateInstance(next); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.DropInstance(last.Key(), "test")
+
+	queries := map[string][]reason.Condition{
+		"all":             nil,
+		"item0":           {reason.WhereEquals("item", "item0")},
+		"no price":        {reason.WhereUnbound("price")},
+		"awaiting Offer":  {reason.WhereEnabled("Buyer", "Offer")},
+		"wrong role":      {reason.WhereEnabled("Seller", "Offer")},
+		"item1, no price": {reason.WhereEquals("item", "item1"), reason.WhereUnbound("price")},
+		"undeclared":      {reason.WhereUnbound("address")},
+	}
+	for name, conditions := range queries {
+		expected := 0
+		for _, i := range r.Instances(p) {
+			matches := true
+			for _, c := range conditions {
+				matches = matches && c.Match(i)
+			}
+			if matches {
+				expected++
+			}
+		}
+		if found := len(r.Query(p, conditions...)); found != expected {
+			t.Errorf("Query '%s' returned %d instances, expected %d", name, found, expected)
+		}
+	}
+	if len(r.Instances(p)) != 29 {
+		t.Fatal("Dropped instance still indexed")
+	}
+	if len(r.Query(p, reason.WhereEnabled("Buyer", "Offer"))) != 10 {
+		t.Fatal("Wrong number of instances awaiting Offer")
+	}
+}
@@ -2,7 +2,7 @@ package implementation
 
 import (
 	"fmt"
-	"strings"
+	"sync"
 
 	"github.com/mikelsr/bspl"
 	"github.com/mikelsr/bspl/proto"
@@ -14,15 +14,120 @@ type Instance struct {
 	protocol proto.Protocol
 	roles    Roles
 	values   Values
+	// parent and children instance keys of composite protocols
+	parent   string
+	children []string
+	// bindings of the actions with an extended key
+	tuples tuples
+	// hash of the protocol, computed once
+	hash *protocolHash
 }
 
-// NewInstance is the default constructor for Instance.
+// protocolHash caches the content hash of the protocol of an instance
+type protocolHash struct {
+	once  sync.Once
+	value string
+}
+
+// knownHash returns a protocolHash with a hash already computed
+func knownHash(hash string) *protocolHash {
+	h := new(protocolHash)
+	h.once.Do(func() { h.value = hash })
+	return h
+}
+
+// protocolHash returns the content hash of the protocol of the instance,
+// see proto.Protocol.Hash
+func (i *Instance) protocolHash() string {
+	if i.hash == nil {
+		return i.protocol.Hash()
+	}
+	i.hash.once.Do(func() { i.hash.value = i.protocol.Hash() })
+	return i.hash.value
+}
+
+// NewInstance is the default constructor for Instance. It creates an
+// instance without values, e.g. to build a newer version of another
+// instance. New enactments should be created with Instantiate.
 func NewInstance(protocol proto.Protocol, roles Roles) *Instance {
-	return &Instance{protocol: protocol, roles: roles, values: make(Values)}
+	return &Instance{protocol: protocol, roles: roles, values: make(Values),
+		hash: new(protocolHash)}
+}
+
+// Instantiate creates a new enactment of a protocol. Every role of the
+// protocol must be assigned, ins must bind its 'in' parameters and keys
+// may bind its other key parameters, as checked by reason.CheckInputs.
+func Instantiate(protocol proto.Protocol, roles Roles, keys Values, ins Values) (*Instance, error) {
+	for _, role := range protocol.Roles {
+		if _, found := roles[role]; !found {
+			return nil, fmt.Errorf("Unassigned role: %s", role)
+		}
+	}
+	if err := reason.CheckInputs(protocol, keys, ins); err != nil {
+		return nil, err
+	}
+	i := NewInstance(protocol, roles)
+	for _, values := range []Values{keys, ins} {
+		for k, v := range values {
+			if err := i.SetValue(k, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return i, nil
+}
+
+// clone returns a copy of the instance that doesn't share its bindings
+func (i *Instance) clone() *Instance {
+	c := &Instance{protocol: i.protocol, roles: make(Roles, len(i.roles)),
+		values: make(Values, len(i.values)), parent: i.parent,
+		children: append([]string(nil), i.children...), hash: i.hash}
+	for k, v := range i.roles {
+		c.roles[k] = v
+	}
+	for k, v := range i.values {
+		c.values[k] = v
+	}
+	if i.tuples != nil {
+		c.tuples = make(tuples, len(i.tuples))
+		for names, byID := range i.tuples {
+			c.tuples[names] = make(map[string]Values, len(byID))
+			for id, tuple := range byID {
+				t := make(Values, len(tuple))
+				for k, v := range tuple {
+					t[k] = v
+				}
+				c.tuples[names][id] = t
+			}
+		}
+	}
+	return c
+}
+
+// AddChild links an instance of a protocol referenced by the protocol of
+// the instance
+func (i *Instance) AddChild(key string) {
+	for _, c := range i.children {
+		if c == key {
+			return
+		}
+	}
+	i.children = append(i.children, key)
+}
+
+// Children returns the keys of the child instances
+func (i *Instance) Children() []string {
+	return append([]string(nil), i.children...)
+}
+
+// Parent returns the key of the parent instance, if any
+func (i *Instance) Parent() string {
+	return i.parent
 }
 
 // Diff identifies what action has been run between two versions of an
-// instance. It returns the action, the new values and an error.
+// instance. It returns the action, the new values and an error, a
+// reason.IntegrityViolation if they bind a parameter to different values.
 // Currently only one action is supported between instace versions.
 // An action slice is returned because two actions may have happened,
 // e.g. Accept or Reject. In that case the Reasoner must find out which
@@ -34,14 +139,19 @@ func (i *Instance) Diff(j reason.Instance) ([]bspl.Action, Values, error) {
 		value, found := i.Parameters()[paramStr]
 		if found {
 			if value != newValue {
-				return nil, nil, fmt.Errorf("Mismatched values for param '%s'", paramStr)
+				name := paramStr
+				if param, found := i.paramFromString(paramStr); found {
+					name = param.Name
+				}
+				return nil, nil, reason.IntegrityViolation{Instance: i.Key(),
+					Param: name, Known: value, Received: newValue}
 			} else if value != "" {
 				continue
 			}
 		}
 		param, found := i.paramFromString(paramStr)
 		if !found {
-			panic(fmt.Errorf("Parameter not found: '%s'", paramStr))
+			return nil, nil, fmt.Errorf("Parameter not found: '%s'", paramStr)
 		}
 		diffParams[paramStr] = param
 		diffValues[param.Name] = newValue
@@ -70,48 +180,36 @@ func (i *Instance) Diff(j reason.Instance) ([]bspl.Action, Values, error) {
 	return actions, diffValues, nil
 }
 
-// Equals compares two instances.
-func (i *Instance) Equals(j reason.Instance) bool {
-	if !(i.Key() == j.Key() && i.values.Equals(j.Parameters())) {
-		return false
-	}
-	if len(i.Roles()) != len(j.Roles()) {
-		return false
-	}
-	for k, v1 := range i.Roles() {
-		if v2 := i.Roles()[k]; v1 != v2 {
-			return false
-		}
+// GetValue returns the value of the parameter of an instance.
+func (i *Instance) GetValue(parameter string) string {
+	if param, found := i.param(parameter); found {
+		return i.Parameters()[param.String()]
 	}
-	return true
+	return ""
 }
 
-// GetValue returns the value of the parameter of an instance.
-func (i *Instance) GetValue(parameter string) string {
-	for _, param := range i.Protocol().Parameters() {
-		if param.Name == parameter {
-			return i.Parameters()[param.String()]
+// param returns the parameter a value is stored by: the declaration of the
+// protocol or, for the parameters of its actions it doesn't declare, an
+// untyped 'out' parameter, see proto.Protocol.Undeclared
+func (i *Instance) param(name string) (proto.Parameter, bool) {
+	if param, found := i.protocol.Param(name); found {
+		return param, true
+	}
+	for _, undeclared := range i.protocol.Undeclared() {
+		if undeclared == name {
+			return proto.Parameter{Name: name, Io: proto.Out}, true
 		}
 	}
-	return ""
+	return proto.Parameter{}, false
 }
 
-// Key of the instance.
+// Key of the instance, see InstanceKey.
 func (i *Instance) Key() string {
-	keys := i.protocol.Keys()
-	n := len(keys)
-
-	var sb strings.Builder
-	sb.WriteString(i.protocol.Key())
-	sb.WriteRune(instanceSeparator)
-	for j, k := range keys {
-		v := i.values[k.String()]
-		sb.WriteString(string(v))
-		if j != n-1 {
-			sb.WriteRune(proto.KeySeparator)
-		}
+	values := make(Values)
+	for _, k := range i.protocol.Keys() {
+		values[k.Name] = i.values[k.String()]
 	}
-	return sb.String()
+	return NewInstanceKey(i.protocol, values).String()
 }
 
 // Parameters of the Instance.
@@ -130,13 +228,19 @@ func (i *Instance) Roles() Roles {
 	return i.roles
 }
 
-// SetValue of an instance parameter.
-func (i *Instance) SetValue(parameter string, value string) {
-	for _, param := range i.Protocol().Parameters() {
-		if param.Name == parameter {
-			i.Parameters()[param.String()] = value
-		}
+// SetValue of an instance parameter. The value must belong to the type
+// of the parameter. Parameters of the actions the protocol doesn't declare
+// are kept untyped, other parameters are ignored.
+func (i *Instance) SetValue(parameter string, value string) error {
+	param, found := i.param(parameter)
+	if !found {
+		return nil
+	}
+	if err := param.Type.Check(value); err != nil {
+		return fmt.Errorf("Invalid value for '%s': %s", parameter, err)
 	}
+	i.Parameters()[param.String()] = value
+	return nil
 }
 
 // Update updates an instance given the same instance
@@ -148,6 +252,12 @@ func (i *Instance) Update(j reason.Instance) error {
 	if err != nil {
 		return err
 	}
+	// check every value before setting any
+	for k, v := range values {
+		if err := i.protocol.CheckValue(k, v); err != nil {
+			return err
+		}
+	}
 	// Set parameter value
 	for k, v := range values {
 		i.SetValue(k, v)
@@ -159,11 +269,15 @@ func (i *Instance) Update(j reason.Instance) error {
 // givenit's string form (in ID key). It would be faster if it where parsed
 // but this way we ensure its validity.
 func (i *Instance) paramFromString(str string) (proto.Parameter, bool) {
-	for _, a := range i.protocol.Actions {
-		for _, param := range a.Params {
-			if param.String() == str {
-				return param, true
-			}
+	// values are stored by the string of the protocol parameter
+	for _, param := range i.protocol.Params {
+		if param.String() == str {
+			return param, true
+		}
+	}
+	for _, name := range i.protocol.Undeclared() {
+		if param := (proto.Parameter{Name: name, Io: proto.Out}); param.String() == str {
+			return param, true
 		}
 	}
 	return proto.Parameter{}, false
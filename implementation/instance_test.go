@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/reason"
 )
 
 func TestIntance_Key(t *testing.T) {
@@ -47,6 +48,15 @@ func TestInstance_Diff(t *testing.T) {
 	if len(diff) != 2 {
 		t.Fatal("Missing parameters")
 	}
+	// i3 binds the item of i2 to another value
+	i3 := NewInstance(p, roles)
+	i3.SetValue("ID", "testID")
+	i3.SetValue("item", "otherItem")
+	_, _, err = i2.Diff(i3)
+	v, ok := err.(reason.IntegrityViolation)
+	if !ok || v.Param != "item" || v.Known != "testItem" || v.Received != "otherItem" {
+		t.Fatalf("Expected an integrity violation, found %v", err)
+	}
 }
 
 func TestInstace_Update(t *testing.T) {
@@ -72,3 +82,34 @@ func TestInstace_Update(t *testing.T) {
 		t.Fatal("i1 and i2 differ after update")
 	}
 }
+
+func TestInstance_Undeclared(t *testing.T) {
+	p := testProtocol()
+	// Offer binds an address the protocol doesn't declare
+	p.Actions[0].Params = append(p.Actions[0].Params, proto.Parameter{Name: "address", Io: proto.Out})
+	roles := Roles{"Buyer": "B", "Seller": "S"}
+	i := NewInstance(p, roles)
+	i.SetValue("ID", "testID")
+	i.SetValue("item", "testItem")
+	i.SetValue("madeup", "X")
+	if i.GetValue("madeup") != "" {
+		t.Fatal("Bound a parameter unknown to the protocol")
+	}
+	next := NewInstance(p, roles)
+	next.SetValue("ID", "testID")
+	next.SetValue("price", "testPrice")
+	next.SetValue("address", "testAddress")
+	actions, values, err := i.Diff(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 1 || actions[0].Name != "Offer" || values["address"] != "testAddress" {
+		t.Fatalf("Unexpected diff: %v, %v", actions, values)
+	}
+	if err := i.Update(next); err != nil {
+		t.Fatal(err)
+	}
+	if i.GetValue("address") != "testAddress" || i.GetValue("price") != "testPrice" {
+		t.Fatalf("Unexpected instance: %v", i.Parameters())
+	}
+}
@@ -0,0 +1,161 @@
+package implementation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+// keyEscape precedes the separators and itself in the components of an
+// instance key
+const keyEscape = '\\'
+
+// InstanceKey is the decoded key of an instance: the name of its protocol,
+// the names of the key parameters and their values. Its string form is
+//
+//	Protocol,param1,param2:value1,value2
+//
+// where ',', ':' and '\' are escaped with '\' in every component, so
+// values containing them can be decoded with ParseInstanceKey.
+type InstanceKey struct {
+	Protocol string
+	Params   []string
+	Values   Values
+}
+
+// NewInstanceKey returns the key of the instance of a protocol with the
+// given values
+func NewInstanceKey(p proto.Protocol, values Values) InstanceKey {
+	keys := p.Keys()
+	k := InstanceKey{Protocol: p.Name, Params: make([]string, len(keys)), Values: make(Values)}
+	for i, param := range keys {
+		k.Params[i] = param.Name
+		k.Values[param.Name] = values[param.Name]
+	}
+	return k
+}
+
+// Unbound returns the names of the key parameters without value
+func (k InstanceKey) Unbound() []string {
+	unbound := make([]string, 0)
+	for _, param := range k.Params {
+		if k.Values[param] == "" {
+			unbound = append(unbound, param)
+		}
+	}
+	return unbound
+}
+
+func (k InstanceKey) String() string {
+	var sb strings.Builder
+	sb.WriteString(escapeKey(k.Protocol))
+	sb.WriteRune(proto.KeySeparator)
+	for i, param := range k.Params {
+		if i > 0 {
+			sb.WriteRune(proto.KeySeparator)
+		}
+		sb.WriteString(escapeKey(param))
+	}
+	sb.WriteRune(instanceSeparator)
+	for i, param := range k.Params {
+		if i > 0 {
+			sb.WriteRune(proto.KeySeparator)
+		}
+		sb.WriteString(escapeKey(k.Values[param]))
+	}
+	return sb.String()
+}
+
+// ParseInstanceKey decodes the string form of an InstanceKey. Every key
+// parameter must have a value.
+func ParseInstanceKey(s string) (InstanceKey, error) {
+	parts, err := splitKey(s, instanceSeparator)
+	if err != nil {
+		return InstanceKey{}, fmt.Errorf("Invalid instance key '%s': %s", s, err)
+	}
+	if len(parts) != 2 {
+		return InstanceKey{}, fmt.Errorf("Invalid instance key '%s': expected one '%c'",
+			s, instanceSeparator)
+	}
+	names, err := splitKey(parts[0], proto.KeySeparator)
+	if err != nil {
+		return InstanceKey{}, fmt.Errorf("Invalid instance key '%s': %s", s, err)
+	}
+	values, err := splitKey(parts[1], proto.KeySeparator)
+	if err != nil {
+		return InstanceKey{}, fmt.Errorf("Invalid instance key '%s': %s", s, err)
+	}
+	k := InstanceKey{Protocol: unescapeKey(names[0]), Params: make([]string, 0, len(names)-1),
+		Values: make(Values)}
+	if k.Protocol == "" {
+		return InstanceKey{}, fmt.Errorf("Invalid instance key '%s': missing protocol", s)
+	}
+	if len(names)-1 != len(values) {
+		return InstanceKey{}, fmt.Errorf("Invalid instance key '%s': %d key parameters, %d values",
+			s, len(names)-1, len(values))
+	}
+	for i, name := range names[1:] {
+		param := unescapeKey(name)
+		if param == "" {
+			return InstanceKey{}, fmt.Errorf("Invalid instance key '%s': empty key parameter", s)
+		}
+		k.Params = append(k.Params, param)
+		k.Values[param] = unescapeKey(values[i])
+	}
+	if unbound := k.Unbound(); len(unbound) > 0 {
+		return InstanceKey{}, fmt.Errorf("Invalid instance key '%s': unbound key parameters %s",
+			s, strings.Join(unbound, ", "))
+	}
+	return k, nil
+}
+
+func escapeKey(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if r == keyEscape || r == proto.KeySeparator || r == instanceSeparator {
+			sb.WriteRune(keyEscape)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func unescapeKey(s string) string {
+	var sb strings.Builder
+	escaped := false
+	for _, r := range s {
+		if r == keyEscape && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// splitKey splits an escaped string by the unescaped separators, keeping
+// the escapes
+func splitKey(s string, sep rune) ([]string, error) {
+	parts := make([]string, 0)
+	var sb strings.Builder
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == keyEscape:
+			escaped = true
+		case r == sep:
+			parts = append(parts, sb.String())
+			sb.Reset()
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing '%c'", keyEscape)
+	}
+	return append(parts, sb.String()), nil
+}
@@ -0,0 +1,71 @@
+package implementation
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+func TestInstanceKey(t *testing.T) {
+	p := testProtocol()
+	p.Params = append(p.Params, proto.Parameter{Name: "seq", Key: true, Io: proto.Out})
+	i := NewInstance(p, testRoles())
+	i.SetValue("ID", `a,b:c\d`)
+	i.SetValue("seq", "")
+	expected := `ProtoName,ID,seq:a\,b\:c\\d,`
+	if i.Key() != expected {
+		t.Fatalf("Expected '%s', found '%s'", expected, i.Key())
+	}
+	if _, err := ParseInstanceKey(i.Key()); err == nil {
+		t.Fatal("Parsed a key with unbound parameters")
+	}
+	i.SetValue("seq", "1")
+	k, err := ParseInstanceKey(i.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedKey := InstanceKey{Protocol: "ProtoName", Params: []string{"ID", "seq"},
+		Values: Values{"ID": `a,b:c\d`, "seq": "1"}}
+	if !reflect.DeepEqual(k, expectedKey) || k.String() != i.Key() {
+		t.Fatalf("Unexpected key: %+v", k)
+	}
+	invalid := []string{
+		"",
+		"ProtoName,ID",
+		"ProtoName,ID:X:Y",
+		"ProtoName,ID:X,Y",
+		",ID:X",
+		"ProtoName,,ID:X,Y",
+		`ProtoName,ID:X\`,
+	}
+	for _, s := range invalid {
+		if _, err := ParseInstanceKey(s); err == nil {
+			t.Fatalf("Parsed invalid key '%s'", s)
+		}
+	}
+}
+
+func TestReasoner_RegisterUnboundKey(t *testing.T) {
+	r := NewReasoner(NewFakeClock(time.Unix(0, 0)))
+	if err := r.RegisterInstance(NewInstance(testProtocol(), testRoles())); err == nil {
+		t.Fatal("Registered an instance with an unbound key")
+	}
+	if _, err := r.Instantiate(testProtocol(), testRoles(), Values{}, nil); err == nil {
+		t.Fatal("Instantiated an instance with an unbound key")
+	}
+}
+
+func TestReasoner_ReceiveKeyMismatch(t *testing.T) {
+	r := NewReasoner(NewFakeClock(time.Unix(0, 0)))
+	i := shippingInstance(t, r)
+	offer, _ := shippingMessages("10")
+	offer.Values = Values{"ID": "2", "price": "10"}
+	if _, err := r.Receive(i.Key(), offer); err == nil {
+		t.Fatal("Received a message with another key")
+	}
+	if i.GetValue("price") != "" {
+		t.Fatal("Applied a message with another key")
+	}
+}
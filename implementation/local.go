@@ -0,0 +1,310 @@
+package implementation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/reason"
+)
+
+// LocalInstance is the view of an enactment held by the agent playing a
+// role. Unlike a shared Instance it only learns a binding when the role
+// sends or receives the message carrying it, so messages can be received
+// in any order.
+type LocalInstance struct {
+	*Instance
+	role    proto.Role
+	history []reason.Message
+}
+
+// NewLocalInstance creates the view of a new enactment held by a role.
+// Every role knows the bindings of the keys and the 'in' parameters of the
+// protocol from the start, see Instantiate.
+func NewLocalInstance(protocol proto.Protocol, roles Roles, role proto.Role,
+	keys Values, ins Values) (*LocalInstance, error) {
+	if _, found := roles[role]; !found {
+		return nil, fmt.Errorf("Unassigned role: %s", role)
+	}
+	i, err := Instantiate(protocol, roles, keys, ins)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalInstance{Instance: i, role: role, history: []reason.Message{}}, nil
+}
+
+// Role whose view the instance holds
+func (l *LocalInstance) Role() proto.Role {
+	return l.role
+}
+
+// History returns the messages sent and received by the role, in the
+// order they were sent or received
+func (l *LocalInstance) History() []reason.Message {
+	return append([]reason.Message(nil), l.history...)
+}
+
+// Send an action of the role. The values bind the 'out' parameters of
+// the action and its 'in' parameters are taken from the local view, which
+// must know them. It returns the message to deliver to the recipient.
+func (l *LocalInstance) Send(actionName string, values Values) (reason.Message, error) {
+	var action proto.Action
+	found := false
+	for _, a := range l.protocol.Actions {
+		if a.Name == actionName && a.From == l.role {
+			action, found = a, true
+			break
+		}
+	}
+	if !found {
+		return reason.Message{}, fmt.Errorf("Role %s can't send action '%s'", l.role, actionName)
+	}
+	if !reason.Enabled(l, action) {
+		return reason.Message{}, fmt.Errorf("Action '%s' is not enabled for role %s",
+			action, l.role)
+	}
+	m := reason.Message{
+		Protocol: l.protocol.Key(),
+		Action:   action,
+		Roles:    l.roles,
+		Values:   make(Values),
+	}
+	for _, param := range action.Ins() {
+		m.Values[param.Name] = l.GetValue(param.Name)
+	}
+	for _, param := range action.Outs() {
+		value := values[param.Name]
+		if value == "" {
+			return reason.Message{}, fmt.Errorf("Missing value for '%s'", param.Name)
+		}
+		if err := l.protocol.CheckValue(param.Name, value); err != nil {
+			return reason.Message{}, err
+		}
+		m.Values[param.Name] = value
+	}
+	for _, param := range action.Outs() {
+		l.SetValue(param.Name, m.Values[param.Name])
+	}
+	l.history = append(l.history, m)
+	return m, nil
+}
+
+// Receive a message sent to the role. The local view learns the bindings
+// carried by the message, whether or not it already knows the bindings of
+// its 'in' parameters. Redeliveries are ignored and bindings contradicting
+// the local view are rejected with a ReconciliationError and nothing is
+// learned.
+func (l *LocalInstance) Receive(m reason.Message) error {
+	if m.Protocol != l.protocol.Key() {
+		return fmt.Errorf("Message of protocol '%s' received by an instance of '%s'",
+			m.Protocol, l.protocol.Key())
+	}
+	if m.Action.To != l.role {
+		return fmt.Errorf("Action '%s' is not for role %s", m.Action, l.role)
+	}
+	found := false
+	for _, a := range l.protocol.Actions {
+		if a.String() == m.Action.String() {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("Unknown action: '%s'", m.Action)
+	}
+	for _, h := range l.history {
+		if h.Action.To == l.role && h.ID() == m.ID() {
+			// redelivery
+			return nil
+		}
+	}
+	contradictions := make([]Contradiction, 0)
+	for _, param := range m.Action.Params {
+		if param.Io == proto.Nil {
+			continue
+		}
+		value := m.Values[param.Name]
+		if value == "" {
+			return fmt.Errorf("Missing value for '%s'", param.Name)
+		}
+		if err := l.protocol.CheckValue(param.Name, value); err != nil {
+			return err
+		}
+		if known := l.GetValue(param.Name); known != "" && known != value {
+			contradictions = append(contradictions, Contradiction{Param: param.Name,
+				Values: map[proto.Role]string{l.role: known, m.Action.From: value}})
+		}
+	}
+	if len(contradictions) > 0 {
+		return ReconciliationError{Protocol: l.protocol.Name, Contradictions: contradictions}
+	}
+	for _, param := range m.Action.Params {
+		if param.Io != proto.Nil {
+			l.SetValue(param.Name, m.Values[param.Name])
+		}
+	}
+	l.history = append(l.history, m)
+	return nil
+}
+
+// Contradiction between the bindings of a parameter known by different
+// roles
+type Contradiction struct {
+	Param  string                `json:"parameter"`
+	Values map[proto.Role]string `json:"values"`
+}
+
+func (c Contradiction) String() string {
+	roles := make([]proto.Role, 0, len(c.Values))
+	for r := range c.Values {
+		roles = append(roles, r)
+	}
+	proto.SortRoles(roles)
+	values := make([]string, len(roles))
+	for i, r := range roles {
+		values[i] = fmt.Sprintf("%s='%s'", r, c.Values[r])
+	}
+	return fmt.Sprintf("'%s': %s", c.Param, strings.Join(values, ", "))
+}
+
+// ReconciliationError is returned when the local views of an enactment
+// contradict each other
+type ReconciliationError struct {
+	Protocol       string
+	Contradictions []Contradiction
+}
+
+func (e ReconciliationError) Error() string {
+	cs := make([]string, len(e.Contradictions))
+	for i, c := range e.Contradictions {
+		cs[i] = c.String()
+	}
+	return fmt.Sprintf("Contradicting bindings in '%s': %s", e.Protocol, strings.Join(cs, "; "))
+}
+
+// Reconcile checks that the local views of an enactment never bind a
+// parameter to different values. It returns a ReconciliationError with
+// every contradiction, sorted by parameter.
+func Reconcile(locals ...*LocalInstance) error {
+	if len(locals) == 0 {
+		return nil
+	}
+	bindings := make(map[string]map[proto.Role]string)
+	for _, l := range locals {
+		names := l.protocol.Undeclared()
+		for _, param := range l.protocol.Parameters() {
+			names = append(names, param.Name)
+		}
+		for _, name := range names {
+			v := l.GetValue(name)
+			if v == "" {
+				continue
+			}
+			if _, found := bindings[name]; !found {
+				bindings[name] = make(map[proto.Role]string)
+			}
+			bindings[name][l.role] = v
+		}
+	}
+	params := make([]string, 0, len(bindings))
+	for param := range bindings {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	contradictions := make([]Contradiction, 0)
+	for _, param := range params {
+		distinct := make(map[string]bool)
+		for _, v := range bindings[param] {
+			distinct[v] = true
+		}
+		if len(distinct) > 1 {
+			contradictions = append(contradictions,
+				Contradiction{Param: param, Values: bindings[param]})
+		}
+	}
+	if len(contradictions) > 0 {
+		return ReconciliationError{Protocol: locals[0].protocol.Name,
+			Contradictions: contradictions}
+	}
+	return nil
+}
+
+// Network of the local instances of an enactment, one per role, connected
+// by an asynchronous channel that delivers messages in any order
+type Network struct {
+	locals   map[proto.Role]*LocalInstance
+	inFlight []reason.Message
+}
+
+// NewNetwork creates a local instance of a new enactment for every role
+// of the protocol
+func NewNetwork(protocol proto.Protocol, roles Roles, keys Values, ins Values) (*Network, error) {
+	n := &Network{locals: make(map[proto.Role]*LocalInstance, len(protocol.Roles)),
+		inFlight: []reason.Message{}}
+	for _, r := range protocol.Roles {
+		l, err := NewLocalInstance(protocol, roles, r, keys, ins)
+		if err != nil {
+			return nil, err
+		}
+		n.locals[r] = l
+	}
+	return n, nil
+}
+
+// Local returns the local instance of a role
+func (n *Network) Local(r proto.Role) (*LocalInstance, bool) {
+	l, found := n.locals[r]
+	return l, found
+}
+
+// Send an action of a role, the message stays in flight until delivered
+func (n *Network) Send(r proto.Role, actionName string, values Values) error {
+	l, found := n.locals[r]
+	if !found {
+		return fmt.Errorf("Unknown role: %s", r)
+	}
+	m, err := l.Send(actionName, values)
+	if err != nil {
+		return err
+	}
+	n.inFlight = append(n.inFlight, m)
+	return nil
+}
+
+// InFlight returns the messages sent and not yet delivered, in the order
+// they were sent
+func (n *Network) InFlight() []reason.Message {
+	return append([]reason.Message(nil), n.inFlight...)
+}
+
+// Deliver the message in flight with the given index to its recipient.
+// Messages may be delivered in any order. The message is dropped from
+// the channel even if the recipient rejects it.
+func (n *Network) Deliver(index int) error {
+	if index < 0 || index >= len(n.inFlight) {
+		return fmt.Errorf("No message in flight with index %d", index)
+	}
+	m := n.inFlight[index]
+	n.inFlight = append(n.inFlight[:index:index], n.inFlight[index+1:]...)
+	l, found := n.locals[m.Action.To]
+	if !found {
+		return fmt.Errorf("Unknown role: %s", m.Action.To)
+	}
+	return l.Receive(m)
+}
+
+// Reconcile checks that the local views of the roles never contradict
+// each other, see Reconcile
+func (n *Network) Reconcile() error {
+	roles := make([]proto.Role, 0, len(n.locals))
+	for r := range n.locals {
+		roles = append(roles, r)
+	}
+	proto.SortRoles(roles)
+	locals := make([]*LocalInstance, len(roles))
+	for i, r := range roles {
+		locals[i] = n.locals[r]
+	}
+	return Reconcile(locals...)
+}
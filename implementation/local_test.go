@@ -0,0 +1,173 @@
+package implementation
+
+import (
+	"testing"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+func localProtocol() proto.Protocol {
+	buyer := proto.Role("Buyer")
+	seller := proto.Role("Seller")
+	return proto.Protocol{
+		Name:  "Pay",
+		Roles: []proto.Role{buyer, seller},
+		Params: []proto.Parameter{
+			{Name: "ID", Key: true, Io: proto.Out},
+			{Name: "item", Io: proto.Out},
+			{Name: "amount", Io: proto.Out, Type: proto.Int},
+			{Name: "decision", Io: proto.Out},
+		},
+		Actions: []proto.Action{
+			{Name: "Request", From: buyer, To: seller, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.Out},
+				{Name: "item", Io: proto.Out},
+			}},
+			{Name: "Pay", From: buyer, To: seller, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "amount", Io: proto.Out},
+			}},
+			{Name: "Ship", From: seller, To: buyer, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "decision", Io: proto.Out},
+			}},
+			{Name: "Cancel", From: buyer, To: seller, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "decision", Io: proto.Out},
+			}},
+		},
+	}
+}
+
+func localNetwork(t *testing.T) *Network {
+	t.Helper()
+	roles := Roles{proto.Role("Buyer"): "B", proto.Role("Seller"): "S"}
+	n, err := NewNetwork(localProtocol(), roles, nil, Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestNetwork_Reordering(t *testing.T) {
+	n := localNetwork(t)
+	buyer, _ := n.Local("Buyer")
+	seller, _ := n.Local("Seller")
+	if err := n.Send("Buyer", "Request", Values{"ID": "1", "item": "book"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Send("Buyer", "Pay", Values{"amount": "10"}); err != nil {
+		t.Fatal(err)
+	}
+	// the seller can't ship before learning the ID
+	if err := n.Send("Seller", "Ship", Values{"decision": "shipped"}); err == nil {
+		t.Fatal("Expected Ship to be disabled")
+	}
+	// Pay overtakes Request
+	if err := n.Deliver(1); err != nil {
+		t.Fatal(err)
+	}
+	if seller.GetValue("ID") != "1" || seller.GetValue("amount") != "10" ||
+		seller.GetValue("item") != "" {
+		t.Fatalf("Unexpected seller view: %v", seller.Parameters())
+	}
+	if err := n.Deliver(0); err != nil {
+		t.Fatal(err)
+	}
+	if seller.GetValue("item") != "book" || len(n.InFlight()) != 0 {
+		t.Fatalf("Unexpected seller view: %v", seller.Parameters())
+	}
+	if h := seller.History(); len(h) != 2 || h[0].Action.Name != "Pay" {
+		t.Fatalf("Unexpected history: %v", h)
+	}
+	if err := n.Send("Seller", "Ship", Values{"decision": "shipped"}); err != nil {
+		t.Fatal(err)
+	}
+	// the buyer doesn't know the decision until Ship is delivered
+	if buyer.GetValue("decision") != "" {
+		t.Fatal("Expected the buyer not to know the decision")
+	}
+	if err := n.Deliver(0); err != nil {
+		t.Fatal(err)
+	}
+	if buyer.GetValue("decision") != "shipped" {
+		t.Fatal("Expected the buyer to learn the decision")
+	}
+	if err := n.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNetwork_Reconcile(t *testing.T) {
+	n := localNetwork(t)
+	buyer, _ := n.Local("Buyer")
+	n.Send("Buyer", "Request", Values{"ID": "1", "item": "book"})
+	n.Deliver(0)
+	// Ship and Cancel cross each other
+	if err := n.Send("Seller", "Ship", Values{"decision": "shipped"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Send("Buyer", "Cancel", Values{"decision": "cancelled"}); err != nil {
+		t.Fatal(err)
+	}
+	err := n.Reconcile()
+	re, ok := err.(ReconciliationError)
+	if !ok || len(re.Contradictions) != 1 || re.Contradictions[0].Param != "decision" ||
+		re.Contradictions[0].Values["Seller"] != "shipped" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "Contradicting bindings in 'Pay': 'decision': Buyer='cancelled', Seller='shipped'"
+	if err.Error() != expected {
+		t.Fatalf("Expected '%s', found '%s'", expected, err)
+	}
+	// the buyer rejects the contradicting Ship
+	if err := n.Deliver(0); err == nil {
+		t.Fatal("Expected a contradiction")
+	} else if _, ok := err.(ReconciliationError); !ok {
+		t.Fatalf("Unexpected error type %T", err)
+	}
+	if buyer.GetValue("decision") != "cancelled" || len(n.InFlight()) != 1 {
+		t.Fatalf("Unexpected buyer view: %v", buyer.Parameters())
+	}
+}
+
+func TestLocalInstance_Receive(t *testing.T) {
+	roles := Roles{proto.Role("Buyer"): "B", proto.Role("Seller"): "S"}
+	buyer, _ := NewLocalInstance(localProtocol(), roles, "Buyer", nil, Values{})
+	seller, _ := NewLocalInstance(localProtocol(), roles, "Seller", nil, Values{})
+	if _, err := NewLocalInstance(localProtocol(), roles, "Shipper", nil, Values{}); err == nil {
+		t.Fatal("Expected an unassigned role")
+	}
+	if _, err := seller.Send("Request", Values{"ID": "1", "item": "book"}); err == nil {
+		t.Fatal("Expected the seller not to send Request")
+	}
+	m, err := buyer.Send("Request", Values{"ID": "1", "item": "book"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := buyer.Receive(m); err == nil {
+		t.Fatal("Expected the buyer not to receive its own message")
+	}
+	if _, err := buyer.Send("Pay", Values{"amount": "ten"}); err == nil {
+		t.Fatal("Expected an invalid amount")
+	}
+	m.Values["item"] = ""
+	if err := seller.Receive(m); err == nil {
+		t.Fatal("Expected a missing value")
+	}
+}
+
+func TestLocalInstance_Redelivery(t *testing.T) {
+	roles := Roles{proto.Role("Buyer"): "B", proto.Role("Seller"): "S"}
+	buyer, _ := NewLocalInstance(localProtocol(), roles, "Buyer", nil, Values{})
+	seller, _ := NewLocalInstance(localProtocol(), roles, "Seller", nil, Values{})
+	m, _ := buyer.Send("Request", Values{"ID": "1", "item": "book"})
+	for n := 0; n < 2; n++ {
+		if err := seller.Receive(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(seller.History()) != 1 {
+		t.Fatalf("Expected the redelivery to be ignored: %v", seller.History())
+	}
+}
@@ -4,15 +4,33 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 
 	"github.com/mikelsr/bspl/parser"
 	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/registry"
 )
 
+const (
+	// FullVersion of the instance encoding embeds the text of the protocol.
+	// Records without a version use it.
+	FullVersion = 1
+	// CompactVersion of the instance encoding references the protocol by
+	// key and content hash
+	CompactVersion = 2
+)
+
+// instanceMarshaller is the versioned envelope of an encoded instance
 type instanceMarshaller struct {
-	Protocol string `json:"protocol"`
-	Roles    Roles  `json:"roles"`
-	Values   Values `json:"protocol_values"`
+	Version      int      `json:"version,omitempty"`
+	Protocol     string   `json:"protocol,omitempty"`
+	ProtocolKey  string   `json:"protocol_key,omitempty"`
+	ProtocolHash string   `json:"protocol_hash,omitempty"`
+	Roles        Roles    `json:"roles"`
+	Values       Values   `json:"protocol_values"`
+	Parent       string   `json:"parent,omitempty"`
+	Children     []string `json:"children,omitempty"`
+	Tuples       tuples   `json:"tuples,omitempty"`
 }
 
 // MarshalAction marshals an Action into bytes
@@ -42,28 +60,94 @@ func UnmarshalAction(a *proto.Action, b []byte) error {
 	return nil
 }
 
-// Marshal an Instance
+// Marshal an Instance embedding the text of its protocol
 func (i *Instance) Marshal() ([]byte, error) {
 	im := instanceMarshaller{
+		Version:  FullVersion,
 		Protocol: i.protocol.String(),
 		Roles:    i.roles,
 		Values:   i.values,
+		Parent:   i.parent,
+		Children: i.children,
+		Tuples:   i.tuples,
 	}
 	return json.Marshal(im)
 }
 
-// Unmarshal an instance
+// MarshalCompact marshals an Instance referencing its protocol by key
+// and content hash. Decoding it requires a registry.Registry holding the
+// protocol, see UnmarshalInstance.
+func (i *Instance) MarshalCompact() ([]byte, error) {
+	im := instanceMarshaller{
+		Version:      CompactVersion,
+		ProtocolKey:  i.protocol.Key(),
+		ProtocolHash: i.protocolHash(),
+		Roles:        i.roles,
+		Values:       i.values,
+		Parent:       i.parent,
+		Children:     i.children,
+		Tuples:       i.tuples,
+	}
+	return json.Marshal(im)
+}
+
+// Unmarshal an instance embedding the text of its protocol. Compact
+// instances require a registry, see UnmarshalInstance.
 func (i *Instance) Unmarshal(data []byte) error {
+	return i.unmarshal(data, nil)
+}
+
+// UnmarshalInstance decodes an instance of any version. The protocols
+// of compact instances are looked up by content hash in the registry.
+func UnmarshalInstance(data []byte, r *registry.Registry) (*Instance, error) {
+	i := new(Instance)
+	if err := i.unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+func (i *Instance) unmarshal(data []byte, r *registry.Registry) error {
 	im := new(instanceMarshaller)
 	if err := json.Unmarshal(data, im); err != nil {
 		return err
 	}
-	p, err := parser.Parse(bytes.NewReader([]byte(im.Protocol)))
-	if err != nil {
-		return err
+	var p proto.Protocol
+	hash := new(protocolHash)
+	switch im.Version {
+	case 0, FullVersion:
+		var err error
+		if p, err = parser.Parse(bytes.NewReader([]byte(im.Protocol))); err != nil {
+			return err
+		}
+	case CompactVersion:
+		if r == nil {
+			return errors.New("Compact instance requires a protocol registry")
+		}
+		var err error
+		if p, err = lookupProtocol(r, im.ProtocolKey, im.ProtocolHash); err != nil {
+			return err
+		}
+		hash = knownHash(im.ProtocolHash)
+	default:
+		return fmt.Errorf("Unknown instance encoding version: %d", im.Version)
 	}
 	i.protocol = p
+	i.hash = hash
 	i.roles = im.Roles
 	i.values = im.Values
+	i.parent = im.Parent
+	i.children = im.Children
+	i.tuples = im.Tuples
 	return nil
 }
+
+// lookupProtocol resolves the protocol of a compact instance by content
+// hash
+func lookupProtocol(r *registry.Registry, key string, hash string) (proto.Protocol, error) {
+	e, found := r.ByHash(hash)
+	if !found {
+		return proto.Protocol{}, fmt.Errorf("Protocol '%s' with hash %s not found", key, hash)
+	}
+	return e.Protocol, nil
+}
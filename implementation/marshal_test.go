@@ -2,9 +2,11 @@ package implementation
 
 import (
 	"bytes"
+	"encoding/json"
 	"testing"
 
 	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/registry"
 )
 
 func TestMarshalAction(t *testing.T) {
@@ -60,3 +62,69 @@ func testInstanceUnmarshal(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestInstance_MarshalCompact(t *testing.T) {
+	expected := testInstance()
+	full, _ := expected.Marshal()
+	compact, err := expected.MarshalCompact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compact) >= len(full) {
+		t.Fatal("Compact encoding is not smaller")
+	}
+	r := registry.New()
+	if _, err := r.Register(testProtocol(), "1"); err != nil {
+		t.Fatal(err)
+	}
+	i, err := UnmarshalInstance(compact, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expected.Equals(i) {
+		t.FailNow()
+	}
+	// full records are decoded too
+	if i, err = UnmarshalInstance(full, r); err != nil || !expected.Equals(i) {
+		t.Fatal(err)
+	}
+	if _, err := UnmarshalInstance(compact, registry.New()); err == nil {
+		t.Fatal("Decoded instance of unknown protocol")
+	}
+	if err := new(Instance).Unmarshal(compact); err == nil {
+		t.Fatal("Decoded compact instance without registry")
+	}
+	// a protocol with the same key but different content
+	changed := testProtocol()
+	changed.Actions = changed.Actions[:1]
+	other := registry.New()
+	if _, err := other.Register(changed, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UnmarshalInstance(compact, other); err == nil {
+		t.Fatal("Decoded instance of a different version of the protocol")
+	}
+}
+
+func TestInstance_UnmarshalVersions(t *testing.T) {
+	expected := testInstance()
+	// records written before the envelope was versioned
+	legacy, err := json.Marshal(map[string]interface{}{
+		"protocol":        expected.Protocol().String(),
+		"roles":           expected.Roles(),
+		"protocol_values": expected.Parameters(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := new(Instance)
+	if err := i.Unmarshal(legacy); err != nil {
+		t.Fatal(err)
+	}
+	if !expected.Equals(i) {
+		t.FailNow()
+	}
+	if err := i.Unmarshal([]byte(`{"version": 99}`)); err == nil {
+		t.Fatal("Decoded unknown version")
+	}
+}
@@ -0,0 +1,344 @@
+package implementation
+
+import (
+	"fmt"
+
+	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/reason"
+)
+
+// parked message waiting for the 'in' parameters it carries to be known
+// by its instance
+type parked struct {
+	m     reason.Message
+	timer reason.Timer
+}
+
+func (p *parked) stop() {
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+}
+
+// discarded parked message and the motive
+type discarded struct {
+	m   reason.Message
+	err error
+}
+
+// Pending returns the messages parked for an instance, in the order they
+// were received
+func (r *Reasoner) Pending(instanceKey string) []reason.Message {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ms := make([]reason.Message, len(r.pending[instanceKey]))
+	for i, p := range r.pending[instanceKey] {
+		ms[i] = p.m
+	}
+	return ms
+}
+
+// Receive applies a message received by an agent to an instance.
+// Redeliveries, identified by the ID of the message or because the
+// instance already knows its bindings, are ignored, while messages binding
+// known parameters to different values return a reason.IntegrityViolation.
+// If the instance doesn't know the 'in' parameters of the action yet the
+// message is parked, up to the limit of the Reasoner, until a later
+// message binds them or it expires. Parked messages that fail once retried
+// are discarded. It returns the messages applied, in order.
+func (r *Reasoner) Receive(instanceKey string, m reason.Message) ([]reason.Message, error) {
+	r.mu.Lock()
+	applied, discards, err := r.receive(instanceKey, m)
+	r.mu.Unlock()
+	// discard without holding the lock, OnDiscard may use the Reasoner
+	for _, d := range discards {
+		r.pendingOpts.OnDiscard(instanceKey, d.m, d.err)
+	}
+	return applied, err
+}
+
+// receive a message, must be called holding r.mu
+func (r *Reasoner) receive(instanceKey string, m reason.Message) ([]reason.Message, []discarded, error) {
+	i, found := r.instances[instanceKey]
+	if !found {
+		return nil, nil, fmt.Errorf("Instance not found: '%s'", instanceKey)
+	}
+	if err := checkKeys(i, m); err != nil {
+		return nil, nil, err
+	}
+	v, err := viewOf(i, m)
+	if err != nil {
+		return nil, nil, err
+	}
+	// redeliveries are ignored
+	if r.received[instanceKey][m.ID()] || v.duplicate(m) {
+		return []reason.Message{}, nil, nil
+	}
+	ok, err := v.ready(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		if err := r.park(instanceKey, m); err != nil {
+			return nil, nil, err
+		}
+		r.markReceived(instanceKey, m, true)
+		return []reason.Message{}, nil, nil
+	}
+	if err := r.apply(i, m); err != nil {
+		return nil, nil, err
+	}
+	r.markReceived(instanceKey, m, true)
+	applied := []reason.Message{m}
+	discards := make([]discarded, 0)
+	// applying a parked message may enable others
+	for retry := true; retry; {
+		retry = false
+		for n, p := range r.pending[instanceKey] {
+			v, err := viewOf(i, p.m)
+			ok := false
+			if err == nil {
+				ok, err = v.ready(p.m)
+			}
+			if err == nil && !ok {
+				continue
+			}
+			r.unpark(instanceKey, n)
+			if err == nil {
+				err = r.apply(i, p.m)
+			}
+			if err != nil {
+				r.markReceived(instanceKey, p.m, false)
+				discards = append(discards, discarded{m: p.m, err: err})
+			} else {
+				applied = append(applied, p.m)
+			}
+			retry = true
+			break
+		}
+	}
+	return applied, discards, nil
+}
+
+// view of the bindings visible to a message: those of the tuple of the
+// extended key of its action, if it has one, and those of the instance
+type view struct {
+	i      reason.Instance
+	action proto.Action
+	// key of the tuple, nil for actions without an extended key
+	key   Values
+	tuple Values
+}
+
+func viewOf(i reason.Instance, m reason.Message) (view, error) {
+	p := i.Protocol()
+	v := view{i: i}
+	found := false
+	for _, a := range p.Actions {
+		if a.String() == m.Action.String() {
+			v.action, found = a, true
+			break
+		}
+	}
+	if !found {
+		return v, fmt.Errorf("Unknown action: '%s'", m.Action)
+	}
+	if len(p.ExtendedKey(v.action)) == 0 {
+		return v, nil
+	}
+	ts, ok := i.(reason.TupleStore)
+	if !ok {
+		return v, fmt.Errorf("Instance '%s' can't hold the tuples of action '%s'",
+			i.Key(), v.action.Name)
+	}
+	key, err := reason.TupleKey(p, v.action, m.Values)
+	if err != nil {
+		return v, err
+	}
+	v.key = key
+	v.tuple, _ = ts.Tuple(key)
+	return v, nil
+}
+
+// value of a parameter in the view, the keys of a tuple are only bound
+// once the tuple exists
+func (v view) value(param string) string {
+	if v.key == nil {
+		return v.i.GetValue(param)
+	}
+	if _, isKey := v.key[param]; isKey {
+		return v.tuple[param]
+	}
+	return reason.TupleValue(v.i, v.tuple, param)
+}
+
+// tracked returns true if the view can hold the binding of a parameter.
+// Instances only hold parameters declared by the protocol, tuples hold
+// any parameter.
+func (v view) tracked(param string) bool {
+	if v.key != nil {
+		return true
+	}
+	_, declared := v.i.Protocol().Param(param)
+	return declared
+}
+
+// ready returns true if the view knows the 'in' parameters carried by a
+// message, and an error if it knows different values.
+func (v view) ready(m reason.Message) (bool, error) {
+	known := true
+	for _, param := range v.action.Ins() {
+		if !v.tracked(param.Name) {
+			continue
+		}
+		switch value := v.value(param.Name); value {
+		case "":
+			known = false
+		case m.Values[param.Name]:
+		default:
+			return false, reason.IntegrityViolation{Instance: v.i.Key(), Action: v.action.Name,
+				Param: param.Name, Known: value, Received: m.Values[param.Name]}
+		}
+	}
+	return known, nil
+}
+
+// duplicate returns true if the view already knows every binding carried
+// by a message of an action with 'out' parameters
+func (v view) duplicate(m reason.Message) bool {
+	outs := 0
+	for _, param := range v.action.Params {
+		if param.Io == proto.Nil || !v.tracked(param.Name) {
+			continue
+		}
+		if param.Io == proto.Out {
+			outs++
+		}
+		if v.value(param.Name) != m.Values[param.Name] {
+			return false
+		}
+	}
+	return outs > 0
+}
+
+// checkKeys checks that the key bindings carried by a message match the
+// instance it is routed to
+func checkKeys(i reason.Instance, m reason.Message) error {
+	for _, k := range i.Protocol().Keys() {
+		v, found := m.Values[k.Name]
+		if !found {
+			continue
+		}
+		if bound := i.GetValue(k.Name); v != bound {
+			return fmt.Errorf("Message '%s' binds key '%s' to '%s' but is routed to '%s'",
+				m.Action.Name, k.Name, v, i.Key())
+		}
+	}
+	return nil
+}
+
+// markReceived records whether a message has been received by an instance,
+// must be called holding r.mu
+func (r *Reasoner) markReceived(instanceKey string, m reason.Message, received bool) {
+	ids, found := r.received[instanceKey]
+	if !received {
+		delete(ids, m.ID())
+		return
+	}
+	if !found {
+		ids = make(map[string]bool)
+		r.received[instanceKey] = ids
+	}
+	ids[m.ID()] = true
+}
+
+// apply the bindings of a message to an instance, or to the tuple of the
+// extended key of its action, must be called holding r.mu
+func (r *Reasoner) apply(i reason.Instance, m reason.Message) error {
+	v, err := viewOf(i, m)
+	if err != nil {
+		return err
+	}
+	if v.key != nil {
+		err = r.applyTuple(i, v, m)
+	} else {
+		next := NewInstance(i.Protocol(), i.Roles())
+		for _, k := range i.Protocol().Keys() {
+			next.SetValue(k.Name, i.GetValue(k.Name))
+		}
+		for k, value := range m.Values {
+			if err := next.SetValue(k, value); err != nil {
+				return err
+			}
+		}
+		err = r.update(next)
+	}
+	if violation, ok := err.(reason.IntegrityViolation); ok {
+		violation.Action = m.Action.Name
+		return violation
+	}
+	return err
+}
+
+// applyTuple binds the parameters of a message other than the key of the
+// protocol in a tuple, must be called holding r.mu
+func (r *Reasoner) applyTuple(i reason.Instance, v view, m reason.Message) error {
+	protocolKeys := make(map[string]bool)
+	for _, k := range i.Protocol().Keys() {
+		protocolKeys[k.Name] = true
+	}
+	values := make(Values)
+	for _, param := range v.action.Params {
+		if param.Io != proto.Nil && !protocolKeys[param.Name] {
+			values[param.Name] = m.Values[param.Name]
+		}
+	}
+	if err := i.(reason.TupleStore).BindTuple(v.key, values); err != nil {
+		return err
+	}
+	return r.updated(i)
+}
+
+// park a message, must be called holding r.mu
+func (r *Reasoner) park(instanceKey string, m reason.Message) error {
+	if len(r.pending[instanceKey]) >= r.pendingOpts.MaxMessages {
+		return reason.ErrPendingFull
+	}
+	p := &parked{m: m}
+	if r.pendingOpts.Expiry > 0 {
+		p.timer = r.scheduler.clock.AfterFunc(r.pendingOpts.Expiry,
+			func() { r.expire(instanceKey, p) })
+	}
+	r.pending[instanceKey] = append(r.pending[instanceKey], p)
+	return nil
+}
+
+// unpark the message with the given index, must be called holding r.mu
+func (r *Reasoner) unpark(instanceKey string, n int) {
+	queue := r.pending[instanceKey]
+	queue[n].stop()
+	if len(queue) == 1 {
+		delete(r.pending, instanceKey)
+		return
+	}
+	r.pending[instanceKey] = append(queue[:n:n], queue[n+1:]...)
+}
+
+func (r *Reasoner) expire(instanceKey string, p *parked) {
+	r.mu.Lock()
+	found := false
+	for n, x := range r.pending[instanceKey] {
+		if x == p {
+			r.unpark(instanceKey, n)
+			// a redelivery may be parked again
+			r.markReceived(instanceKey, p.m, false)
+			found = true
+			break
+		}
+	}
+	r.mu.Unlock()
+	// the message may have been retried while the timer was firing
+	if found {
+		r.pendingOpts.OnDiscard(instanceKey, p.m, reason.ErrPendingExpired)
+	}
+}
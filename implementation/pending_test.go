@@ -0,0 +1,169 @@
+package implementation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/reason"
+)
+
+func shippingProtocol() proto.Protocol {
+	buyer := proto.Role("Buyer")
+	seller := proto.Role("Seller")
+	shipper := proto.Role("Shipper")
+	return proto.Protocol{
+		Name:  "Shipping",
+		Roles: []proto.Role{buyer, seller, shipper},
+		Params: []proto.Parameter{
+			{Name: "ID", Key: true, Io: proto.Out},
+			{Name: "price", Io: proto.Out, Type: proto.Int},
+			{Name: "receipt", Io: proto.Out},
+		},
+		Actions: []proto.Action{
+			{Name: "Offer", From: seller, To: buyer, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.Out},
+				{Name: "price", Io: proto.Out},
+			}},
+			{Name: "Deliver", From: shipper, To: buyer, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "price", Io: proto.In},
+				{Name: "receipt", Io: proto.Out},
+			}},
+		},
+	}
+}
+
+func shippingMessages(price string) (offer, deliver reason.Message) {
+	p := shippingProtocol()
+	roles := Roles{"Buyer": "B", "Seller": "S", "Shipper": "H"}
+	offer = reason.Message{Protocol: p.Key(), Action: p.Actions[0], Roles: roles,
+		Values: Values{"ID": "1", "price": "10"}}
+	deliver = reason.Message{Protocol: p.Key(), Action: p.Actions[1], Roles: roles,
+		Values: Values{"ID": "1", "price": price, "receipt": "R"}}
+	return offer, deliver
+}
+
+func shippingInstance(t *testing.T, r *Reasoner) reason.Instance {
+	t.Helper()
+	i, err := r.Instantiate(shippingProtocol(), Roles{"Buyer": "B", "Seller": "S", "Shipper": "H"},
+		Values{"ID": "1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
+
+func TestReasoner_Receive(t *testing.T) {
+	r := NewReasoner(NewFakeClock(time.Unix(0, 0)))
+	i := shippingInstance(t, r)
+	offer, deliver := shippingMessages("10")
+	// Deliver overtakes Offer
+	applied, err := r.Receive(i.Key(), deliver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 || len(r.Pending(i.Key())) != 1 || i.GetValue("receipt") != "" {
+		t.Fatal("Expected Deliver to be parked")
+	}
+	applied, err = r.Receive(i.Key(), offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 || applied[0].Action.Name != "Offer" || applied[1].Action.Name != "Deliver" {
+		t.Fatalf("Unexpected applied messages: %v", applied)
+	}
+	if i.GetValue("receipt") != "R" || len(r.Pending(i.Key())) != 0 {
+		t.Fatal("Expected Deliver to be applied")
+	}
+	if _, err := r.Receive("Shipping,ID:2", offer); err == nil {
+		t.Fatal("Received a message for a missing instance")
+	}
+}
+
+func TestReasoner_ReceiveDiscard(t *testing.T) {
+	var discarded []error
+	r := NewReasoner(NewFakeClock(time.Unix(0, 0)), reason.WithMaxPending(1),
+		reason.OnPendingDiscard(func(_ string, _ reason.Message, err error) {
+			discarded = append(discarded, err)
+		}))
+	i := shippingInstance(t, r)
+	offer, deliver := shippingMessages("5")
+	if _, err := r.Receive(i.Key(), deliver); err != nil {
+		t.Fatal(err)
+	}
+	// redeliveries are not parked twice
+	if _, err := r.Receive(i.Key(), deliver); err != nil {
+		t.Fatal(err)
+	}
+	other := deliver
+	other.Values = Values{"ID": "1", "price": "5", "receipt": "R2"}
+	if _, err := r.Receive(i.Key(), other); err != reason.ErrPendingFull {
+		t.Fatalf("Expected a full queue, found %v", err)
+	}
+	// the parked Deliver contradicts the price of the Offer
+	applied, err := r.Receive(i.Key(), offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || len(discarded) != 1 || len(r.Pending(i.Key())) != 0 {
+		t.Fatalf("Expected Deliver to be discarded, applied %v", applied)
+	}
+	// once known, contradicting values are rejected without parking
+	if _, err := r.Receive(i.Key(), deliver); err == nil {
+		t.Fatal("Received a contradicting message")
+	}
+}
+
+func TestReasoner_ReceiveExpiry(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var discarded []error
+	r := NewReasoner(clock, reason.WithPendingExpiry(time.Minute),
+		reason.OnPendingDiscard(func(_ string, _ reason.Message, err error) {
+			discarded = append(discarded, err)
+		}))
+	i := shippingInstance(t, r)
+	_, deliver := shippingMessages("10")
+	r.Receive(i.Key(), deliver)
+	clock.Advance(30 * time.Second)
+	if len(r.Pending(i.Key())) != 1 {
+		t.Fatal("Parked message expired too soon")
+	}
+	clock.Advance(time.Minute)
+	if len(r.Pending(i.Key())) != 0 || len(discarded) != 1 || discarded[0] != reason.ErrPendingExpired {
+		t.Fatalf("Expected the parked message to expire, discarded %v", discarded)
+	}
+	// dropping an instance drops its parked messages
+	r.Receive(i.Key(), deliver)
+	r.DropInstance(i.Key(), "test")
+	clock.Advance(2 * time.Minute)
+	if len(r.Pending(i.Key())) != 0 || len(discarded) != 1 {
+		t.Fatal("Expected the parked message to be dropped with the instance")
+	}
+}
+
+func TestReasoner_ReceiveDuplicate(t *testing.T) {
+	r := NewReasoner(NewFakeClock(time.Unix(0, 0)))
+	i := shippingInstance(t, r)
+	offer, _ := shippingMessages("10")
+	if applied, err := r.Receive(i.Key(), offer); err != nil || len(applied) != 1 {
+		t.Fatalf("Unexpected result: %v, %v", applied, err)
+	}
+	if applied, err := r.Receive(i.Key(), offer); err != nil || len(applied) != 0 {
+		t.Fatalf("Expected the redelivery to be ignored: %v, %v", applied, err)
+	}
+	conflicting := offer
+	conflicting.Values = Values{"ID": "1", "price": "12"}
+	if conflicting.ID() == offer.ID() {
+		t.Fatal("Expected messages with different values to have different IDs")
+	}
+	_, err := r.Receive(i.Key(), conflicting)
+	expected := reason.IntegrityViolation{Instance: i.Key(), Action: "Offer", Param: "price",
+		Known: "10", Received: "12"}
+	if err != expected {
+		t.Fatalf("Expected %v, found %v", expected, err)
+	}
+	if i.GetValue("price") != "10" {
+		t.Fatal("Conflicting duplicate applied")
+	}
+}
@@ -0,0 +1,309 @@
+package implementation
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/reason"
+)
+
+// Reasoner keeps protocol instances in memory. Instances are indexed by
+// parameter binding as they are registered and updated through the Reasoner.
+type Reasoner struct {
+	mu        sync.RWMutex
+	instances map[string]reason.Instance
+	// indexes of the instances by protocol key
+	indexes   map[string]*index
+	scheduler *Scheduler
+	// messages parked by instance key until their 'in' parameters are
+	// known
+	pending     map[string][]*parked
+	pendingOpts reason.PendingOptions
+	// IDs of the messages received by instance key
+	received map[string]map[string]bool
+}
+
+// NewReasoner is the default constructor for Reasoner. The clock is
+// used to expire instances with a deadline or an idle timeout and parked
+// messages, which are limited by the options.
+func NewReasoner(clock reason.Clock, opts ...reason.PendingOption) *Reasoner {
+	r := &Reasoner{
+		instances:   make(map[string]reason.Instance),
+		indexes:     make(map[string]*index),
+		pending:     make(map[string][]*parked),
+		pendingOpts: reason.NewPendingOptions(opts...),
+		received:    make(map[string]map[string]bool),
+	}
+	r.scheduler = NewScheduler(clock, r.DropInstance)
+	return r
+}
+
+// DropInstance cancels an Instance for whatever motive. The child
+// instances of the instance are dropped too.
+func (r *Reasoner) DropInstance(instanceKey string, motive string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, found := r.instances[instanceKey]; !found {
+		return fmt.Errorf("Instance not found: '%s'", instanceKey)
+	}
+	r.drop(instanceKey)
+	return nil
+}
+
+func (r *Reasoner) drop(instanceKey string) {
+	i, found := r.instances[instanceKey]
+	if !found {
+		return
+	}
+	delete(r.instances, instanceKey)
+	if x, found := r.indexes[i.Protocol().Key()]; found {
+		x.remove(instanceKey)
+	}
+	r.scheduler.Cancel(instanceKey)
+	for _, p := range r.pending[instanceKey] {
+		p.stop()
+	}
+	delete(r.pending, instanceKey)
+	delete(r.received, instanceKey)
+	for _, child := range i.Children() {
+		r.drop(child)
+	}
+}
+
+// GetInstance returns an Instance given the instance key
+func (r *Reasoner) GetInstance(instanceKey string) (reason.Instance, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	i, found := r.instances[instanceKey]
+	return i, found
+}
+
+// Snapshot returns a copy of an instance taken holding the lock of the
+// Reasoner, which can be read while the instance is updated. Instances
+// that are not an Instance or a LocalInstance are returned as they are.
+func (r *Reasoner) Snapshot(instanceKey string) (reason.Instance, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	i, found := r.instances[instanceKey]
+	if !found {
+		return nil, false
+	}
+	switch x := i.(type) {
+	case *Instance:
+		return x.clone(), true
+	case *LocalInstance:
+		return &LocalInstance{Instance: x.clone(), role: x.role, history: x.History()}, true
+	}
+	return i, true
+}
+
+// Instances returns all instances of a Protocol
+func (r *Reasoner) Instances(p proto.Protocol) []reason.Instance {
+	return r.Query(p)
+}
+
+// Query returns the instances of a Protocol that meet every condition
+func (r *Reasoner) Query(p proto.Protocol, conditions ...reason.Condition) []reason.Instance {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	instances := make([]reason.Instance, 0)
+	x, found := r.indexes[p.Key()]
+	if !found {
+		return instances
+	}
+	for key := range x.query(conditions...) {
+		instances = append(instances, r.instances[key])
+	}
+	return instances
+}
+
+// Instantiate a protocol. Every role of the protocol must be assigned,
+// its 'in' parameters bound by ins and its other keys by keys, see
+// Instantiate. The options may set a deadline or an idle timeout after
+// which the instance is dropped with reason.MotiveTimeout.
+func (r *Reasoner) Instantiate(p proto.Protocol, roles reason.Roles, keys reason.Values, ins reason.Values, opts ...reason.InstanceOption) (reason.Instance, error) {
+	i, err := Instantiate(p, roles, keys, ins)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.register(i); err != nil {
+		return nil, err
+	}
+	r.scheduler.Schedule(i.Key(), reason.NewInstanceOptions(opts...))
+	return i, nil
+}
+
+// Spawn creates an instance of a protocol referenced by the protocol of a
+// parent instance, with the roles and inputs of the reference bound in the
+// parent. The outputs of the reference are bound in the parent when the
+// child completes.
+func (r *Reasoner) Spawn(parentKey string, child proto.Protocol, opts ...reason.InstanceOption) (reason.Instance, error) {
+	r.mu.Lock()
+	i, err := r.spawn(parentKey, child)
+	r.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	r.scheduler.Schedule(i.Key(), reason.NewInstanceOptions(opts...))
+	return i, nil
+}
+
+// spawn registers a child instance and links it to its parent, must be
+// called holding r.mu
+func (r *Reasoner) spawn(parentKey string, child proto.Protocol) (*Instance, error) {
+	parent, found := r.instances[parentKey]
+	if !found {
+		return nil, fmt.Errorf("Instance not found: '%s'", parentKey)
+	}
+	ref, found := parent.Protocol().Reference(child.Name)
+	if !found {
+		return nil, fmt.Errorf("Protocol '%s' does not reference '%s'", parent.Protocol().Name, child.Name)
+	}
+	roles, ins, err := reason.ChildBindings(parent, ref, child)
+	if err != nil {
+		return nil, err
+	}
+	i, err := Instantiate(child, roles, nil, ins)
+	if err != nil {
+		return nil, err
+	}
+	i.parent = parentKey
+	if err := r.add(i); err != nil {
+		return nil, err
+	}
+	parent.AddChild(i.Key())
+	return i, nil
+}
+
+// RegisterInstance registers an Instance created by another Reasoner.
+// Every key parameter of the instance must be bound.
+func (r *Reasoner) RegisterInstance(i reason.Instance) error {
+	return r.register(i)
+}
+
+// UpdateInstance updates an instance with a newer version of itself
+// as long as a valid run from one to the other. Updating an instance
+// restarts its idle timeout. When the instance of a referenced protocol
+// completes, its outputs are bound in its parent.
+func (r *Reasoner) UpdateInstance(newVersion reason.Instance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.update(newVersion)
+}
+
+// BindTuple binds values in the tuple of an instance identified by the
+// values of an extended key, see Instance.BindTuple. Binding a tuple
+// restarts the idle timeout of the instance, like UpdateInstance.
+func (r *Reasoner) BindTuple(instanceKey string, key Values, values Values) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i, found := r.instances[instanceKey]
+	if !found {
+		return fmt.Errorf("Instance not found: '%s'", instanceKey)
+	}
+	ts, ok := i.(reason.TupleStore)
+	if !ok {
+		return fmt.Errorf("Instance '%s' does not keep tuples", instanceKey)
+	}
+	if err := ts.BindTuple(key, values); err != nil {
+		return err
+	}
+	return r.updated(i)
+}
+
+// update an instance, must be called holding r.mu
+func (r *Reasoner) update(newVersion reason.Instance) error {
+	key := newVersion.Key()
+	i, found := r.instances[key]
+	if !found {
+		return fmt.Errorf("Instance not found: '%s'", key)
+	}
+	// protocols that only differ in the types of their parameters have
+	// the same key
+	if hashOf(i) != hashOf(newVersion) {
+		return fmt.Errorf("Instance '%s' updated with another version of protocol '%s'",
+			key, i.Protocol().Name)
+	}
+	if err := i.Update(newVersion); err != nil {
+		return err
+	}
+	return r.updated(i)
+}
+
+// updated re-indexes an updated instance, restarts its idle timeout and
+// completes it if it is a finished child, must be called holding r.mu
+func (r *Reasoner) updated(i reason.Instance) error {
+	r.indexes[i.Protocol().Key()].add(i)
+	r.scheduler.Touch(i.Key())
+	if i.Parent() != "" && reason.Complete(i) {
+		return r.complete(i)
+	}
+	return nil
+}
+
+// complete binds the outputs of a completed child instance in its parent,
+// which may complete in turn. Nothing is bound if any output contradicts
+// the parent. It must be called holding r.mu.
+func (r *Reasoner) complete(child reason.Instance) error {
+	parent, found := r.instances[child.Parent()]
+	if !found {
+		// the parent was dropped
+		return nil
+	}
+	ref, found := parent.Protocol().Reference(child.Protocol().Name)
+	if !found {
+		return fmt.Errorf("Protocol '%s' does not reference '%s'",
+			parent.Protocol().Name, child.Protocol().Name)
+	}
+	outs := make(Values)
+	for _, out := range ref.Outs() {
+		v := child.GetValue(out.Name)
+		if bound := parent.GetValue(out.Name); bound != "" {
+			if bound != v {
+				return fmt.Errorf("Output '%s' of '%s' is already bound", out.Name, ref.Name)
+			}
+			continue
+		}
+		if err := parent.Protocol().CheckValue(out.Name, v); err != nil {
+			return err
+		}
+		outs[out.Name] = v
+	}
+	for k, v := range outs {
+		parent.SetValue(k, v)
+	}
+	return r.updated(parent)
+}
+
+func (r *Reasoner) register(i reason.Instance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.add(i)
+}
+
+// add an instance, must be called holding r.mu
+func (r *Reasoner) add(i reason.Instance) error {
+	values := make(reason.Values)
+	for _, k := range i.Protocol().Keys() {
+		values[k.Name] = i.GetValue(k.Name)
+	}
+	if unbound := NewInstanceKey(i.Protocol(), values).Unbound(); len(unbound) > 0 {
+		return fmt.Errorf("Unbound key parameters of '%s': %s",
+			i.Protocol().Name, strings.Join(unbound, ", "))
+	}
+	key := i.Key()
+	if _, found := r.instances[key]; found {
+		return fmt.Errorf("Instance already registered: '%s'", key)
+	}
+	r.instances[key] = i
+	protoKey := i.Protocol().Key()
+	x, found := r.indexes[protoKey]
+	if !found {
+		x = newIndex(i.Protocol())
+		r.indexes[protoKey] = x
+	}
+	x.add(i)
+	return nil
+}
@@ -0,0 +1,139 @@
+package implementation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/reason"
+)
+
+func testRoles() Roles {
+	return Roles{
+		proto.Role("Buyer"):  "B",
+		proto.Role("Seller"): "S",
+	}
+}
+
+func TestReasoner_Instantiate(t *testing.T) {
+	r := NewReasoner(NewFakeClock(time.Unix(0, 0)))
+	p := testProtocol()
+	i, err := r.Instantiate(p, testRoles(), Values{"ID": "X"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := r.GetInstance(i.Key()); !found {
+		t.Fatal("Instance not registered")
+	}
+	if len(r.Instances(p)) != 1 {
+		t.FailNow()
+	}
+	// same key
+	if _, err := r.Instantiate(p, testRoles(), Values{"ID": "X"}, nil); err == nil {
+		t.Fatal("Instantiated a repeated instance")
+	}
+	// unassigned role
+	if _, err := r.Instantiate(p, Roles{proto.Role("Buyer"): "B"}, Values{"ID": "Y"}, nil); err == nil {
+		t.Fatal("Instantiated with missing roles")
+	}
+	if err := r.DropInstance(i.Key(), "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DropInstance(i.Key(), "test"); err == nil {
+		t.Fatal("Dropped missing instance")
+	}
+}
+
+func TestReasoner_InstantiateInputs(t *testing.T) {
+	r := NewReasoner(NewFakeClock(time.Unix(0, 0)))
+	p := testProtocol()
+	p.Params = append(p.Params, proto.Parameter{Name: "budget", Io: proto.In, Type: proto.Int})
+	if _, err := r.Instantiate(p, testRoles(), Values{"ID": "X"}, nil); err == nil {
+		t.Fatal("Instantiated without inputs")
+	}
+	if _, err := r.Instantiate(p, testRoles(), Values{"ID": "X"}, Values{"budget": "10", "item": "I"}); err == nil {
+		t.Fatal("Instantiated with extra inputs")
+	}
+	if _, err := r.Instantiate(p, testRoles(), nil, Values{"ID": "X", "budget": "10"}); err == nil {
+		t.Fatal("Instantiated with an 'out' key as input")
+	}
+	if _, err := r.Instantiate(p, testRoles(), Values{"ID": "X"}, Values{"budget": "ten"}); err == nil {
+		t.Fatal("Instantiated with an invalid input")
+	}
+	i, err := r.Instantiate(p, testRoles(), Values{"ID": "X"}, Values{"budget": "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.GetValue("budget") != "10" || len(r.Instances(p)) != 1 {
+		t.Fatal("Input not bound")
+	}
+}
+
+func TestReasoner_Deadline(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	r := NewReasoner(clock)
+	i, err := r.Instantiate(testProtocol(), testRoles(), Values{"ID": "X"}, nil,
+		reason.WithDeadline(clock.Now().Add(time.Minute)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(59 * time.Second)
+	if _, found := r.GetInstance(i.Key()); !found {
+		t.Fatal("Instance dropped before deadline")
+	}
+	clock.Advance(time.Second)
+	if _, found := r.GetInstance(i.Key()); found {
+		t.Fatal("Instance not dropped after deadline")
+	}
+}
+
+func TestReasoner_IdleTimeout(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	r := NewReasoner(clock)
+	i, err := r.Instantiate(testProtocol(), testRoles(), Values{"ID": "X"}, nil,
+		reason.WithIdleTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(30 * time.Second)
+	// run "Request"
+	next := NewInstance(testProtocol(), testRoles())
+	next.SetValue("ID", "X")
+	next.SetValue("item", "I")
+	if err := r.UpdateInstance(next); err != nil {
+		t.Fatal(err)
+	}
+	// the update restarted the timeout
+	clock.Advance(59 * time.Second)
+	if _, found := r.GetInstance(i.Key()); !found {
+		t.Fatal("Instance dropped before timeout")
+	}
+	clock.Advance(time.Second)
+	if _, found := r.GetInstance(i.Key()); found {
+		t.Fatal("Instance not dropped after timeout")
+	}
+}
+
+func TestReasoner_UpdateVersion(t *testing.T) {
+	r := NewReasoner(NewFakeClock(time.Unix(0, 0)))
+	i, err := r.Instantiate(testProtocol(), testRoles(), Values{"ID": "X"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// same key, but price is typed
+	typed := testProtocol()
+	typed.Params[2].Type = proto.Decimal
+	next := NewInstance(typed, testRoles())
+	next.SetValue("ID", "X")
+	next.SetValue("item", "I")
+	if next.Key() != i.Key() {
+		t.Fatal("Expected the versions to have the same key")
+	}
+	if err := r.UpdateInstance(next); err == nil {
+		t.Fatal("Updated an instance with another version of its protocol")
+	}
+	next.SetValue("price", "1")
+	if _, _, err := i.Diff(next); err == nil {
+		t.Fatal("Diffed an instance with another version of its protocol")
+	}
+}
@@ -0,0 +1,115 @@
+package implementation
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mikelsr/bspl/reason"
+)
+
+// Scheduler drops instances once their deadline or idle timeout expires
+type Scheduler struct {
+	clock reason.Clock
+	drop  func(instanceKey string, motive string) error
+
+	mu        sync.Mutex
+	schedules map[string]*schedule
+}
+
+// schedule of a single instance
+type schedule struct {
+	opts         reason.InstanceOptions
+	lastActivity time.Time
+	timer        reason.Timer
+}
+
+// expiry returns the time at which the instance must be dropped
+func (s *schedule) expiry() time.Time {
+	expiry := s.opts.Deadline
+	if s.opts.IdleTimeout > 0 {
+		idle := s.lastActivity.Add(s.opts.IdleTimeout)
+		if expiry.IsZero() || idle.Before(expiry) {
+			expiry = idle
+		}
+	}
+	return expiry
+}
+
+// NewScheduler is the default constructor for Scheduler. The drop
+// function is called with reason.MotiveTimeout for every expired instance.
+func NewScheduler(clock reason.Clock, drop func(instanceKey string, motive string) error) *Scheduler {
+	return &Scheduler{clock: clock, drop: drop, schedules: make(map[string]*schedule)}
+}
+
+// Schedule the drop of an instance. Options that do not expire are ignored.
+func (s *Scheduler) Schedule(instanceKey string, opts reason.InstanceOptions) {
+	if !opts.Expires() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, found := s.schedules[instanceKey]; found {
+		old.timer.Stop()
+	}
+	sch := &schedule{opts: opts, lastActivity: s.clock.Now()}
+	s.schedules[instanceKey] = sch
+	s.arm(instanceKey, sch)
+}
+
+// Touch records activity on an instance, restarting its idle timeout.
+func (s *Scheduler) Touch(instanceKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sch, found := s.schedules[instanceKey]
+	if !found || sch.opts.IdleTimeout == 0 {
+		return
+	}
+	sch.timer.Stop()
+	sch.lastActivity = s.clock.Now()
+	s.arm(instanceKey, sch)
+}
+
+// Cancel the scheduled drop of an instance.
+func (s *Scheduler) Cancel(instanceKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sch, found := s.schedules[instanceKey]; found {
+		sch.timer.Stop()
+		delete(s.schedules, instanceKey)
+	}
+}
+
+// Expiry returns the time at which an instance will be dropped.
+func (s *Scheduler) Expiry(instanceKey string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sch, found := s.schedules[instanceKey]
+	if !found {
+		return time.Time{}, false
+	}
+	return sch.expiry(), true
+}
+
+// arm starts the timer of a schedule. Must be called holding s.mu.
+func (s *Scheduler) arm(instanceKey string, sch *schedule) {
+	d := sch.expiry().Sub(s.clock.Now())
+	if d < 0 {
+		d = 0
+	}
+	sch.timer = s.clock.AfterFunc(d, func() { s.fire(instanceKey, sch) })
+}
+
+func (s *Scheduler) fire(instanceKey string, sch *schedule) {
+	s.mu.Lock()
+	// the schedule may have been cancelled or replaced while the
+	// timer was firing
+	if current, found := s.schedules[instanceKey]; !found || current != sch ||
+		s.clock.Now().Before(sch.expiry()) {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.schedules, instanceKey)
+	s.mu.Unlock()
+	// drop without holding the lock, the dropper may call Cancel
+	s.drop(instanceKey, reason.MotiveTimeout)
+}
@@ -0,0 +1,39 @@
+package implementation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikelsr/bspl/reason"
+)
+
+func TestScheduler(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	dropped := make(map[string]string)
+	s := NewScheduler(clock, func(key string, motive string) error {
+		dropped[key] = motive
+		return nil
+	})
+	s.Schedule("a", reason.NewInstanceOptions(
+		reason.WithDeadline(clock.Now().Add(time.Hour)),
+		reason.WithIdleTimeout(10*time.Minute)))
+	s.Schedule("b", reason.NewInstanceOptions(reason.WithIdleTimeout(time.Minute)))
+	s.Schedule("c", reason.NewInstanceOptions())
+	if _, found := s.Expiry("c"); found {
+		t.Fatal("Scheduled an instance without expiry")
+	}
+	s.Cancel("b")
+	clock.Advance(5 * time.Minute)
+	s.Touch("a")
+	if expiry, _ := s.Expiry("a"); !expiry.Equal(clock.Now().Add(10 * time.Minute)) {
+		t.Fatalf("Unexpected expiry: %s", expiry)
+	}
+	clock.Advance(9 * time.Minute)
+	if len(dropped) != 0 {
+		t.Fatalf("Unexpected drops: %v", dropped)
+	}
+	clock.Advance(time.Minute)
+	if dropped["a"] != reason.MotiveTimeout || len(dropped) != 1 {
+		t.Fatalf("Unexpected drops: %v", dropped)
+	}
+}
@@ -0,0 +1,123 @@
+package implementation
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/reason"
+)
+
+// tuples of an instance by extended key and tuple id, see tupleID
+type tuples map[string]map[string]Values
+
+// tupleID encodes the names of an extended key and the values of a tuple
+// like the components of an InstanceKey
+func tupleID(key Values) (names string, values string) {
+	ks := make([]string, 0, len(key))
+	for k := range key {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	escapedNames := make([]string, len(ks))
+	escapedValues := make([]string, len(ks))
+	for i, k := range ks {
+		escapedNames[i] = escapeKey(k)
+		escapedValues[i] = escapeKey(key[k])
+	}
+	sep := string(proto.KeySeparator)
+	return strings.Join(escapedNames, sep), strings.Join(escapedValues, sep)
+}
+
+// Tuple returns the bindings of the tuple identified by the values of an
+// extended key, and false if nothing is bound for it.
+func (i *Instance) Tuple(key Values) (Values, bool) {
+	names, values := tupleID(key)
+	tuple, found := i.tuples[names][values]
+	if !found {
+		return nil, false
+	}
+	c := make(Values, len(tuple))
+	for k, v := range tuple {
+		c[k] = v
+	}
+	return c, true
+}
+
+// BindTuple binds values in the tuple identified by the values of an
+// extended key. The values must belong to the types of their parameters
+// and agree with the bindings of the tuple, otherwise a
+// reason.IntegrityViolation is returned. Nothing is bound on error.
+func (i *Instance) BindTuple(key Values, values Values) error {
+	names, id := tupleID(key)
+	tuple := i.tuples[names][id]
+	for k, v := range values {
+		if err := i.protocol.CheckValue(k, v); err != nil {
+			return err
+		}
+		if known := tuple[k]; known != "" && known != v {
+			return reason.IntegrityViolation{Instance: i.Key(), Param: k,
+				Known: known, Received: v}
+		}
+	}
+	if i.tuples == nil {
+		i.tuples = make(tuples)
+	}
+	if i.tuples[names] == nil {
+		i.tuples[names] = make(map[string]Values)
+	}
+	if tuple == nil {
+		tuple = make(Values)
+		i.tuples[names][id] = tuple
+	}
+	for k, v := range key {
+		tuple[k] = v
+	}
+	for k, v := range values {
+		tuple[k] = v
+	}
+	return nil
+}
+
+// Tuples returns the tuples of the extended key with the given parameter
+// names that meet every condition, sorted by key.
+func (i *Instance) Tuples(key []string, conditions ...reason.Condition) []Values {
+	names := make(Values, len(key))
+	for _, k := range key {
+		names[k] = ""
+	}
+	signature, _ := tupleID(names)
+	ids := make([]string, 0, len(i.tuples[signature]))
+	for id := range i.tuples[signature] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	matches := make([]Values, 0)
+TUPLES:
+	for _, id := range ids {
+		tuple := i.tuples[signature][id]
+		for _, c := range conditions {
+			if !c.MatchTuple(i, tuple) {
+				continue TUPLES
+			}
+		}
+		c := make(Values, len(tuple))
+		for k, v := range tuple {
+			c[k] = v
+		}
+		matches = append(matches, c)
+	}
+	return matches
+}
+
+// TupleBound returns true if any tuple binds the parameter.
+func (i *Instance) TupleBound(param string) bool {
+	for _, ts := range i.tuples {
+		for _, tuple := range ts {
+			if tuple[param] != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
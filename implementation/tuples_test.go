@@ -0,0 +1,186 @@
+package implementation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/reason"
+)
+
+func orderProtocol() proto.Protocol {
+	p, err := proto.NewBuilder("Order").
+		Roles("Buyer", "Seller").
+		Param(proto.OutParam("ID").AsKey(), proto.OutParam("customer"),
+			proto.OutParam("itemNo").Typed(proto.Int), proto.OutParam("item"),
+			proto.OutParam("shipped")).
+		Action("Buyer", "Seller", "Open", proto.OutParam("ID").AsKey(),
+			proto.OutParam("customer")).
+		Action("Buyer", "Seller", "AddItem", proto.InParam("ID").AsKey(),
+			proto.OutParam("itemNo").AsKey(), proto.OutParam("item")).
+		Action("Seller", "Buyer", "Ship", proto.InParam("ID").AsKey(),
+			proto.InParam("itemNo").AsKey(), proto.InParam("item"), proto.OutParam("shipped")).
+		Build()
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func orderMessage(p proto.Protocol, action string, values Values) reason.Message {
+	m := reason.Message{Protocol: p.Key(), Roles: Roles{"Buyer": "B", "Seller": "S"},
+		Values: values}
+	for _, a := range p.Actions {
+		if a.Name == action {
+			m.Action = a
+		}
+	}
+	return m
+}
+
+func TestReasoner_ReceiveTuples(t *testing.T) {
+	p := orderProtocol()
+	r := NewReasoner(NewFakeClock(time.Unix(0, 0)))
+	i, err := r.Instantiate(p, Roles{"Buyer": "B", "Seller": "S"}, Values{"ID": "1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := i.Key()
+	receive := func(action string, values Values) ([]reason.Message, error) {
+		return r.Receive(key, orderMessage(p, action, values))
+	}
+	// Ship of the first item overtakes AddItem
+	if applied, err := receive("Ship", Values{"ID": "1", "itemNo": "1", "item": "pen",
+		"shipped": "yes"}); err != nil || len(applied) != 0 {
+		t.Fatalf("Expected Ship to be parked: %v, %v", applied, err)
+	}
+	for _, m := range []struct {
+		action string
+		values Values
+	}{
+		{"Open", Values{"ID": "1", "customer": "C"}},
+		{"AddItem", Values{"ID": "1", "itemNo": "1", "item": "pen"}},
+		{"AddItem", Values{"ID": "1", "itemNo": "2", "item": "ink"}},
+	} {
+		if _, err := receive(m.action, m.values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts := i.(*Instance)
+	tuple, found := ts.Tuple(Values{"itemNo": "1"})
+	if !found || tuple["item"] != "pen" || tuple["shipped"] != "yes" || tuple["itemNo"] != "1" {
+		t.Fatalf("Unexpected tuple: %v", tuple)
+	}
+	if !reason.Complete(i) || len(r.Pending(key)) != 0 {
+		t.Fatal("Expected the order to be complete")
+	}
+	// every item is a tuple of the same instance
+	if all := ts.Tuples([]string{"itemNo"}); len(all) != 2 || all[1]["item"] != "ink" {
+		t.Fatalf("Unexpected tuples: %v", all)
+	}
+	unshipped := ts.Tuples([]string{"itemNo"}, reason.WhereUnbound("shipped"))
+	if len(unshipped) != 1 || unshipped[0]["itemNo"] != "2" {
+		t.Fatalf("Unexpected unshipped tuples: %v", unshipped)
+	}
+	enabled := ts.Tuples([]string{"itemNo"}, reason.WhereEnabled("Seller", "Ship"),
+		reason.WhereEquals("customer", "C"))
+	if len(enabled) != 1 || enabled[0]["itemNo"] != "2" {
+		t.Fatalf("Unexpected enabled tuples: %v", enabled)
+	}
+	// redeliveries are ignored and conflicts reported per tuple
+	if applied, err := receive("AddItem", Values{"ID": "1", "itemNo": "2", "item": "ink"}); err != nil ||
+		len(applied) != 0 {
+		t.Fatalf("Expected the redelivery to be ignored: %v, %v", applied, err)
+	}
+	_, err = receive("AddItem", Values{"ID": "1", "itemNo": "2", "item": "cap"})
+	expected := reason.IntegrityViolation{Instance: key, Action: "AddItem", Param: "item",
+		Known: "ink", Received: "cap"}
+	if err != expected {
+		t.Fatalf("Expected %v, found %v", expected, err)
+	}
+	if _, err := receive("AddItem", Values{"ID": "1", "itemNo": "three", "item": "cap"}); err == nil {
+		t.Fatal("Bound a tuple with an invalid key")
+	}
+	if _, err := receive("AddItem", Values{"ID": "1", "item": "cap"}); err == nil {
+		t.Fatal("Bound a tuple without key")
+	}
+}
+
+func TestInstance_MarshalTuples(t *testing.T) {
+	i := NewInstance(orderProtocol(), Roles{"Buyer": "B", "Seller": "S"})
+	i.SetValue("ID", "1")
+	if err := i.BindTuple(Values{"itemNo": "1"}, Values{"item": "a,b"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := i.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := new(Instance)
+	if err := j.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if tuple, found := j.Tuple(Values{"itemNo": "1"}); !found || tuple["item"] != "a,b" {
+		t.Fatalf("Unexpected tuples: %s", data)
+	}
+}
+
+func TestReasoner_BindTuple(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	r := NewReasoner(clock)
+	i, err := r.Instantiate(orderProtocol(), Roles{"Buyer": "B", "Seller": "S"}, Values{"ID": "1"},
+		nil, reason.WithIdleTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(30 * time.Second)
+	if err := r.BindTuple(i.Key(), Values{"itemNo": "1"}, Values{"item": "pen"}); err != nil {
+		t.Fatal(err)
+	}
+	if tuple, found := i.(*Instance).Tuple(Values{"itemNo": "1"}); !found || tuple["item"] != "pen" {
+		t.Fatalf("Unexpected tuple: %v", tuple)
+	}
+	err = r.BindTuple(i.Key(), Values{"itemNo": "1"}, Values{"item": "cap"})
+	if _, ok := err.(reason.IntegrityViolation); !ok {
+		t.Fatalf("Expected an integrity violation, found %v", err)
+	}
+	if err := r.BindTuple("unknown", Values{"itemNo": "1"}, Values{"item": "pen"}); err == nil {
+		t.Fatal("Bound a tuple of an unknown instance")
+	}
+	// binding the tuple restarted the timeout
+	clock.Advance(59 * time.Second)
+	if _, found := r.GetInstance(i.Key()); !found {
+		t.Fatal("Instance dropped before timeout")
+	}
+	clock.Advance(time.Second)
+	if _, found := r.GetInstance(i.Key()); found {
+		t.Fatal("Instance not dropped after timeout")
+	}
+}
+
+func TestReasoner_Snapshot(t *testing.T) {
+	r := NewReasoner(NewFakeClock(time.Unix(0, 0)))
+	i, err := r.Instantiate(orderProtocol(), Roles{"Buyer": "B", "Seller": "S"}, Values{"ID": "1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.BindTuple(i.Key(), Values{"itemNo": "1"}, Values{"item": "pen"}); err != nil {
+		t.Fatal(err)
+	}
+	s, found := r.Snapshot(i.Key())
+	if !found || !s.Equals(i) {
+		t.Fatalf("Unexpected snapshot: %v", s)
+	}
+	// the snapshot doesn't see later bindings
+	if err := r.BindTuple(i.Key(), Values{"itemNo": "1"}, Values{"shipped": "yes"}); err != nil {
+		t.Fatal(err)
+	}
+	i.SetValue("customer", "C")
+	if tuple, _ := s.(*Instance).Tuple(Values{"itemNo": "1"}); tuple["shipped"] != "" ||
+		s.GetValue("customer") != "" {
+		t.Fatalf("Snapshot shares bindings with the instance: %v", s)
+	}
+	if _, found := r.Snapshot("unknown"); found {
+		t.Fatal("Found a snapshot of an unknown instance")
+	}
+}
@@ -0,0 +1,62 @@
+package implementation
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+// GetInt returns the value of an int parameter
+func (i *Instance) GetInt(parameter string) (int64, error) {
+	value, err := i.typedValue(parameter, proto.Int)
+	if err != nil {
+		return 0, err
+	}
+	return proto.ParseInt(value)
+}
+
+// GetDecimal returns the value of a decimal parameter
+func (i *Instance) GetDecimal(parameter string) (*big.Rat, error) {
+	value, err := i.typedValue(parameter, proto.Decimal)
+	if err != nil {
+		return nil, err
+	}
+	return proto.ParseDecimal(value)
+}
+
+// GetBool returns the value of a bool parameter
+func (i *Instance) GetBool(parameter string) (bool, error) {
+	value, err := i.typedValue(parameter, proto.Bool)
+	if err != nil {
+		return false, err
+	}
+	return proto.ParseBool(value)
+}
+
+// GetTime returns the value of a time parameter
+func (i *Instance) GetTime(parameter string) (time.Time, error) {
+	value, err := i.typedValue(parameter, proto.Time)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return proto.ParseTime(value)
+}
+
+// typedValue returns the value of a bound parameter declared with
+// type t or untyped
+func (i *Instance) typedValue(parameter string, t proto.Type) (string, error) {
+	param, found := i.protocol.Param(parameter)
+	if !found {
+		return "", fmt.Errorf("Parameter not found: '%s'", parameter)
+	}
+	if param.Type != proto.Untyped && param.Type != t {
+		return "", fmt.Errorf("Parameter '%s' is %s, not %s", parameter, param.Type, t)
+	}
+	value := i.GetValue(parameter)
+	if value == "" {
+		return "", fmt.Errorf("Unbound parameter: '%s'", parameter)
+	}
+	return value, nil
+}
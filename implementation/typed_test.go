@@ -0,0 +1,76 @@
+package implementation
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+func testTypedInstance() *Instance {
+	p := testProtocol()
+	p.Params = append(p.Params,
+		proto.Parameter{Name: "quantity", Io: proto.Out, Type: proto.Int},
+		proto.Parameter{Name: "paid", Io: proto.Out, Type: proto.Bool},
+		proto.Parameter{Name: "when", Io: proto.Out, Type: proto.Time})
+	p.Params[2].Type = proto.Decimal
+	return NewInstance(p, testRoles())
+}
+
+func TestInstance_SetValue(t *testing.T) {
+	i := testTypedInstance()
+	if err := i.SetValue("price", "ten"); err == nil {
+		t.Fatal("Set invalid decimal")
+	}
+	if i.GetValue("price") != "" {
+		t.Fatal("Invalid value was set")
+	}
+	if err := i.SetValue("price", "10.5"); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.SetValue("undeclared", "x"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInstance_TypedGetters(t *testing.T) {
+	i := testTypedInstance()
+	now := time.Date(2020, 4, 1, 10, 0, 0, 0, time.UTC)
+	for param, value := range map[string]string{
+		"price":    "10.5",
+		"quantity": "3",
+		"paid":     "true",
+		"when":     now.Format(time.RFC3339),
+		"item":     "7",
+	} {
+		if err := i.SetValue(param, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if price, err := i.GetDecimal("price"); err != nil || price.Cmp(big.NewRat(21, 2)) != 0 {
+		t.Fatal(price, err)
+	}
+	if quantity, err := i.GetInt("quantity"); err != nil || quantity != 3 {
+		t.Fatal(quantity, err)
+	}
+	if paid, err := i.GetBool("paid"); err != nil || !paid {
+		t.Fatal(paid, err)
+	}
+	if when, err := i.GetTime("when"); err != nil || !when.Equal(now) {
+		t.Fatal(when, err)
+	}
+	// untyped parameters can be read as any type
+	if item, err := i.GetInt("item"); err != nil || item != 7 {
+		t.Fatal(item, err)
+	}
+	if _, err := i.GetInt("price"); err == nil {
+		t.Fatal("Read decimal as int")
+	}
+	if _, err := i.GetInt("ID"); err == nil {
+		t.Fatal("Read unbound parameter")
+	}
+	if _, err := i.GetInt("undeclared"); err == nil {
+		t.Fatal("Read undeclared parameter")
+	}
+}
@@ -14,11 +14,13 @@ const (
 	arrow        = "arrow"
 	closeBrace   = "close_brace"
 	closeBracket = "close_bracket"
+	closeParen   = "close_paren"
 	colon        = "colon"
 	comma        = "comma"
 	newline      = "newline"
 	openBrace    = "open_brace"
 	openBracket  = "open_bracket"
+	openParen    = "open_paren"
 	whitespace   = "whitespace"
 	word         = "word"
 
@@ -143,17 +145,37 @@ func groupParamTokens(tokens []am.Token, values []string) ([][]string, error) {
 			groups = append(groups, []string{})
 			continue
 		}
-		if t == word {
+		// colons separate parameters from their types
+		if t == word || t == colon {
 			groups[i] = append(groups[i], values[j])
 			continue
 		}
-		return [][]string{}, ParseError{Expected: "word or ','", Found: values[j]}
+		return [][]string{}, ParseError{Expected: "word, ':' or ','", Found: values[j]}
 	}
 	return groups, nil
 }
 
+// splitParamType separates the optional type annotation of a parameter
+// group: <?scope> <name> <?key> <?: type>
+func splitParamType(g []string) ([]string, proto.Type, error) {
+	for i, v := range g {
+		if v != ":" {
+			continue
+		}
+		if i != len(g)-2 {
+			return nil, proto.Untyped, ParseError{Expected: "<name>: <type>", Found: g}
+		}
+		t := proto.Type(g[i+1])
+		if t == proto.Untyped || !t.Valid() {
+			return nil, proto.Untyped, ParseError{Expected: proto.Types, Found: g[i+1]}
+		}
+		return g[:i], t, nil
+	}
+	return g, proto.Untyped, nil
+}
+
 // parseParams extracts parameter from a token slice from a parameter declaration
-// the expected token input is: <?scope> <name> <?key>, <?scope> <name> <?key>...
+// the expected token input is: <?scope> <name> <?key> <?: type>, <?scope> <name> <?key>...
 func parseParams(tokens []am.Token, values []string) ([]proto.Parameter, error) {
 	NIL := []proto.Parameter{}
 	groups, err := groupParamTokens(tokens, values)
@@ -162,6 +184,10 @@ func parseParams(tokens []am.Token, values []string) ([]proto.Parameter, error)
 	}
 	params := []proto.Parameter{}
 	for _, g := range groups {
+		g, paramType, err := splitParamType(g)
+		if err != nil {
+			return NIL, err
+		}
 		if len(g) < 1 || len(g) > 3 {
 			return NIL, ParamError{Comp: values}
 		}
@@ -211,6 +237,7 @@ func parseParams(tokens []am.Token, values []string) ([]proto.Parameter, error)
 			Io:   scope,
 			Key:  key,
 			Name: name,
+			Type: paramType,
 		})
 	}
 	return params, nil
@@ -306,6 +333,73 @@ func (b *ProtoBuilder) parseActions(tokens []am.Token, values []string) (int, er
 	return i, nil
 }
 
+// parseReference parses a reference to another protocol, the protocol
+// roles playing its roles come before its parameters:
+// <Protocol>(<Role>, <Role>..., <params...>)
+func (b *ProtoBuilder) parseReference(tokens []am.Token, values []string) (int, error) {
+	i := nextNewline(tokens)
+	// minimal number of tokens: Protocol(Role) = 4
+	if i < 4 {
+		return 0, errors.New("Invalid reference")
+	}
+	buff := struct {
+		t []am.Token
+		v []string
+	}{t: tokens[:i], v: values[:i]}
+	if buff.t[0] != word {
+		return 0, ParseError{Expected: "<Protocol name>", Found: buff.v[0]}
+	}
+	name := buff.v[0]
+	if isReserved(name) {
+		return 0, ReservedError{Word: name}
+	}
+	if buff.t[1] != openParen || buff.t[i-1] != closeParen {
+		return 0, ParseError{Expected: "( <roles...>, <params...> )",
+			Found: fmt.Sprintf("%s ... %s", buff.v[1], buff.v[i-1])}
+	}
+	t, v := buff.t[2:i-1], buff.v[2:i-1]
+	// leading words that are roles of the protocol
+	roles := []proto.Role{}
+	j := 0
+	for j < len(t) && t[j] == word && b.isRole(v[j]) && (j+1 == len(t) || t[j+1] == comma) {
+		roles = append(roles, proto.Role(v[j]))
+		j += 2
+	}
+	if len(roles) == 0 {
+		return 0, ParseError{Expected: "<Role>", Found: v}
+	}
+	params := []proto.Parameter{}
+	if j < len(t) {
+		var err error
+		if params, err = parseParams(t[j:], v[j:]); err != nil {
+			return 0, err
+		}
+	}
+	b.p.References = append(b.p.References, proto.Reference{
+		Name:   name,
+		Roles:  roles,
+		Params: params,
+	})
+	return i, nil
+}
+
+// parseStep parses an action or a reference to another protocol
+func (b *ProtoBuilder) parseStep(tokens []am.Token, values []string) (int, error) {
+	if len(tokens) > 1 && tokens[1] == openParen {
+		return b.parseReference(tokens, values)
+	}
+	return b.parseActions(tokens, values)
+}
+
+func (b *ProtoBuilder) isRole(v string) bool {
+	for _, r := range b.p.Roles {
+		if string(r) == v {
+			return true
+		}
+	}
+	return false
+}
+
 // Parse a BSPL protocol definition from a list of tokens and values
 func (b *ProtoBuilder) Parse(tokens []am.Token, values []string) error {
 	i := 0
@@ -325,8 +419,8 @@ func (b *ProtoBuilder) Parse(tokens []am.Token, values []string) error {
 	}
 	i += j + 1
 
-	// parse first action
-	j, err = b.parseActions(tokens[i:], values[i:])
+	// parse first action or reference
+	j, err = b.parseStep(tokens[i:], values[i:])
 	if err != nil {
 		return GlobalParseError{parsed: values[:i], err: err}
 	}
@@ -353,7 +447,7 @@ ACTIONS:
 			}
 			break ACTIONS
 		case word:
-			j, err = b.parseActions(tokens[i:], values[i:])
+			j, err = b.parseStep(tokens[i:], values[i:])
 			if err != nil {
 				return err
 			}
@@ -362,7 +456,7 @@ ACTIONS:
 			return ParseError{Expected: "Action or '}'", Found: values[i]}
 		}
 	}
-	// sort roles and actions
+	// sort parameters and actions, roles keep their order
 	b.p.Sort()
 	return proto.Validate(b.p)
 }
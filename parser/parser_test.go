@@ -169,6 +169,59 @@ func TestParseParams(t *testing.T) {
 	}
 }
 
+func TestParseParams_Types(t *testing.T) {
+	tokens := []am.Token{word, word, word, colon, word, comma, word, word, colon, word}
+	values := []string{Out, "ID", Key, ":", "int", ",", Out, "price", ":", "decimal"}
+	expected := []proto.Parameter{
+		{Io: proto.Out, Name: "ID", Key: true, Type: proto.Int},
+		{Io: proto.Out, Name: "price", Type: proto.Decimal},
+	}
+	params, err := parseParams(tokens, values)
+	if err != nil || !reflect.DeepEqual(params, expected) {
+		t.Fatal(params, err)
+	}
+	// unknown type
+	values[9] = "money"
+	if _, err = parseParams(tokens, values); err == nil {
+		t.FailNow()
+	}
+	values[9] = "decimal"
+	// type before key
+	tokens = []am.Token{word, word, colon, word, word}
+	values = []string{Out, "ID", ":", "int", Key}
+	if _, err = parseParams(tokens, values); err == nil {
+		t.FailNow()
+	}
+	// missing type
+	tokens = []am.Token{word, word, colon}
+	values = []string{Out, "ID", ":"}
+	if _, err = parseParams(tokens, values); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestParse_Types(t *testing.T) {
+	source := `Purchase {
+	role Buyer, Seller
+	parameter out ID key: int, out item, out price: decimal
+
+	Buyer -> Seller: Request[out ID, out item]
+	Seller -> Buyer: Offer[in ID, in item, out price: decimal]
+}`
+	p, err := Parse(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if param, _ := p.Param("price"); param.Type != proto.Decimal {
+		t.FailNow()
+	}
+	// the string form parses back to the same protocol
+	again, err := Parse(strings.NewReader(p.String()))
+	if err != nil || !reflect.DeepEqual(p, again) {
+		t.Fatal(err)
+	}
+}
+
 func TestProtoBuilder_parseProtoParams(t *testing.T) {
 	b := new(ProtoBuilder)
 	tokens := []am.Token{word, word, word, word, comma, word, word, comma, word, word, newline}
@@ -218,3 +271,76 @@ func TestProtoBuilder_Parse(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestParse_References(t *testing.T) {
+	source := `Purchase {
+	role Buyer, Seller
+	parameter out ID key, out item, out price, out receipt
+
+	Buyer -> Seller: Request[out ID, out item]
+	Seller -> Buyer: Offer[in ID, in item, out price]
+	Payment(Buyer, Seller, in ID key, in price, out receipt)
+}`
+	p, err := Parse(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []proto.Reference{{
+		Name:  "Payment",
+		Roles: []proto.Role{"Buyer", "Seller"},
+		Params: []proto.Parameter{
+			{Name: "ID", Key: true, Io: proto.In},
+			{Name: "price", Io: proto.In},
+			{Name: "receipt", Io: proto.Out},
+		},
+	}}
+	if !reflect.DeepEqual(p.References, expected) {
+		t.Fatalf("Unexpected references: %v", p.References)
+	}
+	again, err := Parse(strings.NewReader(p.String()))
+	if err != nil || !reflect.DeepEqual(p, again) {
+		t.Fatal(err)
+	}
+	// references need roles of the protocol
+	invalid := strings.Replace(source, "Payment(Buyer, Seller,", "Payment(", 1)
+	if _, err := Parse(strings.NewReader(invalid)); err == nil {
+		t.Fatal("Parsed reference without roles")
+	}
+	invalid = strings.Replace(source, "out receipt)", "out receipt", 1)
+	if _, err := Parse(strings.NewReader(invalid)); err == nil {
+		t.Fatal("Parsed unclosed reference")
+	}
+}
+
+func TestParse_RoleOrder(t *testing.T) {
+	// roles are not declared in alphabetical order
+	child, err := Parse(strings.NewReader(`Payment {
+	role Payer, Payee
+	parameter in ID key, in price, out receipt
+
+	Payer -> Payee: Pay[in ID key, in price, out receipt]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(child.Roles) != 2 || child.Roles[0] != "Payer" || child.Roles[1] != "Payee" {
+		t.Fatalf("Roles not in declaration order: %v", child.Roles)
+	}
+	p, err := Parse(strings.NewReader(`Purchase {
+	role Seller, Buyer
+	parameter out ID key, out price, out receipt
+
+	Seller -> Buyer: Offer[out ID, out price]
+	Payment(Buyer, Seller, in ID key, in price, out receipt)
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := p.References[0].RoleMap(child)
+	if m["Payer"] != "Buyer" || m["Payee"] != "Seller" {
+		t.Fatalf("Unexpected role map: %v", m)
+	}
+	if again, err := Parse(strings.NewReader(p.String())); err != nil || again.Roles[0] != "Seller" {
+		t.Fatalf("Roles not kept by String: %v, %v", again.Roles, err)
+	}
+}
@@ -0,0 +1,128 @@
+package proto
+
+import (
+	"errors"
+	"fmt"
+)
+
+// InParam creates an untyped in parameter
+func InParam(name string) Parameter {
+	return Parameter{Name: name, Io: In}
+}
+
+// OutParam creates an untyped out parameter
+func OutParam(name string) Parameter {
+	return Parameter{Name: name, Io: Out}
+}
+
+// NilParam creates an untyped nil parameter
+func NilParam(name string) Parameter {
+	return Parameter{Name: name, Io: Nil}
+}
+
+// AsKey returns a copy of the parameter marked as key
+func (p Parameter) AsKey() Parameter {
+	p.Key = true
+	return p
+}
+
+// Typed returns a copy of the parameter with a type
+func (p Parameter) Typed(t Type) Parameter {
+	p.Type = t
+	return p
+}
+
+// Builder constructs protocols in code:
+//
+//	p, err := proto.NewBuilder("Purchase").
+//		Roles("Buyer", "Seller").
+//		Param(proto.OutParam("ID").AsKey(), proto.OutParam("item")).
+//		Action("Buyer", "Seller", "Request", proto.OutParam("ID").AsKey(), proto.OutParam("item")).
+//		Build()
+//
+// Errors are collected as elements are added and returned by Build.
+type Builder struct {
+	p    Protocol
+	errs []error
+}
+
+// NewBuilder is the default constructor for Builder.
+func NewBuilder(name string) *Builder {
+	b := &Builder{p: Protocol{Name: name}}
+	if name == "" {
+		b.errs = append(b.errs, errors.New("Empty protocol name"))
+	}
+	return b
+}
+
+// Roles adds roles to the protocol
+func (b *Builder) Roles(roles ...Role) *Builder {
+	for _, r := range roles {
+		if r == "" {
+			b.errs = append(b.errs, errors.New("Empty role name"))
+			continue
+		}
+		for _, existing := range b.p.Roles {
+			if existing == r {
+				b.errs = append(b.errs, fmt.Errorf("Duplicate role: %s", r))
+			}
+		}
+		b.p.Roles = append(b.p.Roles, r)
+	}
+	return b
+}
+
+// Param adds parameters to the protocol
+func (b *Builder) Param(params ...Parameter) *Builder {
+	b.p.Params = b.addParams(b.p.Params, params, "protocol '"+b.p.Name+"'")
+	return b
+}
+
+// Action adds an action sent by a role to another role
+func (b *Builder) Action(from, to Role, name string, params ...Parameter) *Builder {
+	if name == "" {
+		b.errs = append(b.errs, fmt.Errorf("Empty name of action from %s to %s", from, to))
+	}
+	a := Action{Name: name, From: from, To: to}
+	a.Params = b.addParams(nil, params, "action '"+name+"'")
+	b.p.Actions = append(b.p.Actions, a)
+	return b
+}
+
+func (b *Builder) addParams(dst []Parameter, params []Parameter, owner string) []Parameter {
+	for _, param := range params {
+		if param.Name == "" {
+			b.errs = append(b.errs, fmt.Errorf("Empty parameter name in %s", owner))
+			continue
+		}
+		switch param.Io {
+		case In, Out, Nil:
+		default:
+			b.errs = append(b.errs, fmt.Errorf(
+				"Unknown adornment of parameter '%s' in %s: %s", param.Name, owner, param.Io))
+		}
+		for _, existing := range dst {
+			if existing.Name == param.Name {
+				b.errs = append(b.errs, fmt.Errorf(
+					"Duplicate parameter '%s' in %s", param.Name, owner))
+			}
+		}
+		dst = append(dst, param)
+	}
+	return dst
+}
+
+// Build returns the sorted protocol if it is valid. Otherwise it returns a
+// BuildError with every error found.
+func (b *Builder) Build() (Protocol, error) {
+	p := b.p.Clone()
+	p.Sort()
+	errs := append([]error(nil), b.errs...)
+	if err := Validate(p); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return Protocol{}, BuildError{Errs: errs}
+	}
+	return p, nil
+}
@@ -0,0 +1,46 @@
+package proto
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuilder_Build(t *testing.T) {
+	p, err := NewBuilder("ProtoName").
+		Roles("Buyer", "Seller").
+		Param(OutParam("ID").AsKey(), OutParam("item"), OutParam("price")).
+		Action("Buyer", "Seller", "Request", OutParam("ID").AsKey(), OutParam("item")).
+		Action("Buyer", "Seller", "Offer", InParam("ID").AsKey(), InParam("item"), OutParam("price")).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := testProtocol()
+	expected.Sort()
+	if !reflect.DeepEqual(p, expected) {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", expected, p)
+	}
+	typed := NilParam("price").Typed(Decimal)
+	if typed.Io != Nil || typed.Type != Decimal || typed.Key {
+		t.Fatal(typed)
+	}
+}
+
+func TestBuilder_Errors(t *testing.T) {
+	_, err := NewBuilder("ProtoName").
+		Roles("Buyer", "Buyer").
+		Param(OutParam("ID").AsKey(), OutParam("ID"), Parameter{Name: "x", Io: "inout"}).
+		Action("Buyer", "Seller", "Request", OutParam("ID").AsKey()).
+		Build()
+	be, ok := err.(BuildError)
+	if !ok {
+		t.Fatal(err)
+	}
+	// duplicate role, duplicate parameter, unknown adornment and unknown role
+	if len(be.Errs) != 4 {
+		t.Fatal(err)
+	}
+	if _, err := NewBuilder("").Build(); err == nil {
+		t.Fatal("Built protocol without name")
+	}
+}
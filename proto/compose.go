@@ -0,0 +1,85 @@
+package proto
+
+import "strings"
+
+// Reference to a protocol enacted as a step of a composite protocol, e.g.
+//
+//	Payment(Buyer, Seller, in ID key, in price, out receipt)
+//
+// Roles are the roles of the composite protocol that play the roles of the
+// referenced protocol, in the order the latter declares them. Parameters
+// are shared by name: the referenced protocol takes its 'in' parameters
+// from the bindings of the composite protocol and its 'out' parameters
+// are bound in the composite protocol when it completes.
+type Reference struct {
+	// Name of the referenced protocol
+	Name   string
+	Roles  []Role
+	Params []Parameter
+}
+
+// Parameters of a Reference
+func (r Reference) Parameters() []Parameter {
+	return r.Params
+}
+
+// Keys returns a list of the key parameters of the reference
+func (r Reference) Keys() []Parameter {
+	return findKeys(r.Params)
+}
+
+// Ins returns a list of the parameters the reference takes from the
+// composite protocol
+func (r Reference) Ins() []Parameter {
+	return findIns(r.Params)
+}
+
+// Outs returns a list of the parameters the reference binds in the
+// composite protocol
+func (r Reference) Outs() []Parameter {
+	return findOuts(r.Params)
+}
+
+// RoleMap maps the roles of the referenced protocol to the roles of the
+// composite protocol playing them
+func (r Reference) RoleMap(child Protocol) map[Role]Role {
+	m := make(map[Role]Role, len(child.Roles))
+	for i, role := range child.Roles {
+		if i < len(r.Roles) {
+			m[role] = r.Roles[i]
+		}
+	}
+	return m
+}
+
+// action returns the reference as an action without roles, so it can be
+// checked like one
+func (r Reference) action() Action {
+	return Action{Name: r.Name, Params: r.Params}
+}
+
+func (r Reference) String() string {
+	parts := make([]string, 0, len(r.Roles)+len(r.Params))
+	for _, role := range r.Roles {
+		parts = append(parts, string(role))
+	}
+	for _, p := range r.Params {
+		parts = append(parts, p.String())
+	}
+	return r.Name + "(" + strings.Join(parts, ", ") + ")"
+}
+
+// Reference returns the reference to a protocol by name
+func (p Protocol) Reference(name string) (Reference, bool) {
+	for _, r := range p.References {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Reference{}, false
+}
+
+// Composite returns true if the protocol references other protocols
+func (p Protocol) Composite() bool {
+	return len(p.References) > 0
+}
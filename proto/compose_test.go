@@ -0,0 +1,96 @@
+package proto
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func testComposite() (Protocol, Protocol) {
+	payment := Protocol{
+		Name:  "Payment",
+		Roles: []Role{"Payer", "Payee"},
+		Params: []Parameter{
+			{Name: "ID", Key: true, Io: In},
+			{Name: "price", Io: In},
+			{Name: "receipt", Io: Out},
+		},
+		Actions: []Action{
+			{Name: "Pay", From: "Payer", To: "Payee", Params: []Parameter{
+				{Name: "ID", Key: true, Io: In},
+				{Name: "price", Io: In},
+				{Name: "receipt", Io: Out},
+			}},
+		},
+	}
+	p := testProtocol()
+	p.Params = append(p.Params, Parameter{Name: "receipt", Io: Out})
+	p.References = []Reference{{Name: "Payment", Roles: []Role{"Buyer", "Seller"},
+		Params: []Parameter{
+			{Name: "ID", Key: true, Io: In},
+			{Name: "price", Io: In},
+			{Name: "receipt", Io: Out},
+		}}}
+	return p, payment
+}
+
+func TestValidateComposite(t *testing.T) {
+	p, payment := testComposite()
+	lookup := func(name string) (Protocol, bool) {
+		return payment, name == payment.Name
+	}
+	if err := ValidateComposite(p, lookup); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateStrict(p); err != nil {
+		t.Fatal(err)
+	}
+	if m := p.References[0].RoleMap(payment); m["Payer"] != "Buyer" || m["Payee"] != "Seller" {
+		t.Fatal(m)
+	}
+	// the reference takes price before Offer outputs it
+	p.Actions[1].Params = append(p.Actions[1].Params, Parameter{Name: "receipt", Io: In})
+	if err := Validate(p); !errors.Is(err, Cycle) {
+		t.Fatal(err)
+	}
+	p, _ = testComposite()
+	p.References[0].Roles = []Role{"Buyer", "Bank"}
+	p.References[0].Params = p.References[0].Params[:2]
+	p.References = append(p.References, Reference{Name: "Shipping", Roles: []Role{"Seller"},
+		Params: []Parameter{{Name: "ID", Key: true, Io: In}}})
+	err := ValidateComposite(p, lookup)
+	var ve ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatal(err)
+	}
+	if len(ve.Find(UnknownRole)) != 1 || len(ve.Find(UnknownProtocol)) != 1 {
+		t.Fatal(err)
+	}
+	if issues := ve.Find(ReferenceMismatch); len(issues) != 1 || issues[0].Params[0] != "receipt" {
+		t.Fatal(err)
+	}
+}
+
+func TestReference_Interchange(t *testing.T) {
+	p, _ := testComposite()
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Protocol
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, decoded) {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", p, decoded)
+	}
+	c := p.Clone()
+	c.References[0].Params[0].Name = "X"
+	if p.References[0].Params[0].Name != "ID" || c.Hash() == p.Hash() {
+		t.Fatal("Clone shares references")
+	}
+	if s := p.References[0].String(); s != "Payment(Buyer, Seller, in ID key, in price, out receipt)" {
+		t.Fatal(s)
+	}
+}
@@ -0,0 +1,351 @@
+package proto
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ChangeKind states whether an element was added, removed or changed
+type ChangeKind string
+
+const (
+	// Added element, only present in the new protocol
+	Added ChangeKind = "added"
+	// Removed element, only present in the old protocol
+	Removed ChangeKind = "removed"
+	// Changed element, present in both protocols with different adornments
+	Changed ChangeKind = "changed"
+)
+
+// Element of a protocol affected by a change
+type Element string
+
+const (
+	// RoleElement is a role of the protocol
+	RoleElement Element = "role"
+	// ParamElement is a parameter of the protocol
+	ParamElement Element = "parameter"
+	// ActionElement is an action of the protocol
+	ActionElement Element = "action"
+	// ActionParamElement is a parameter of an action
+	ActionParamElement Element = "action parameter"
+	// ReferenceElement is a reference of a composite protocol
+	ReferenceElement Element = "reference"
+)
+
+// Compatibility of a change for the agents playing a role
+type Compatibility string
+
+const (
+	// Compatible changes let agents built on the old version interoperate
+	// with agents built on the new one
+	Compatible Compatibility = "compatible"
+	// Breaking changes require the agents of a role to be updated
+	Breaking Compatibility = "breaking"
+)
+
+// Change between two versions of a protocol
+type Change struct {
+	Kind    ChangeKind `json:"kind"`
+	Element Element    `json:"element"`
+	// Name of the role, parameter, action or reference
+	Name string `json:"name"`
+	// Action of the parameter for ActionParamElement changes
+	Action string `json:"action,omitempty"`
+	// Old and New representations of the element
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+	// Impact of the change on each role of the old protocol
+	Impact map[Role]Compatibility `json:"impact"`
+}
+
+// Breaking returns true if the change breaks any role
+func (c Change) Breaking() bool {
+	return len(c.BreakingRoles()) > 0
+}
+
+// BreakingRoles returns the sorted roles broken by the change
+func (c Change) BreakingRoles() []Role {
+	rs := make([]Role, 0)
+	for r, comp := range c.Impact {
+		if comp == Breaking {
+			rs = append(rs, r)
+		}
+	}
+	SortRoles(rs)
+	return rs
+}
+
+func (c Change) String() string {
+	var s strings.Builder
+	s.WriteString(string(c.Kind) + " " + string(c.Element) + " " + c.Name)
+	if c.Action != "" {
+		s.WriteString(" of " + c.Action)
+	}
+	if c.Kind == Changed {
+		s.WriteString(": " + c.Old + " -> " + c.New)
+	}
+	if rs := c.BreakingRoles(); len(rs) > 0 {
+		names := make([]string, len(rs))
+		for i, r := range rs {
+			names[i] = string(r)
+		}
+		s.WriteString(" (breaking for " + strings.Join(names, ", ") + ")")
+	}
+	return s.String()
+}
+
+// Changes between two versions of a protocol
+type Changes []Change
+
+// Breaking returns true if any change breaks any role
+func (cs Changes) Breaking() bool {
+	for _, c := range cs {
+		if c.Breaking() {
+			return true
+		}
+	}
+	return false
+}
+
+// For returns the changes that break a role
+func (cs Changes) For(r Role) Changes {
+	filtered := make(Changes, 0)
+	for _, c := range cs {
+		if c.Impact[r] == Breaking {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+// Diff reports the changes from an old to a new version of a protocol and
+// classifies them for each role of the old version:
+//
+//   - Receivers of added actions and senders of removed actions break.
+//   - New obligations on a sender (added or changed action parameters)
+//     break the sender, lost information (removed in and out parameters)
+//     breaks the receiver.
+//   - Changing the key or the type of a parameter breaks every role
+//     using it.
+//   - Adding, removing or changing a reference breaks the roles taking
+//     part in it.
+//
+// Actions are matched by sender, recipient and name and references by
+// name.
+func Diff(old, new Protocol) Changes {
+	changes := make(Changes, 0)
+	changes = append(changes, diffRoles(old, new)...)
+	changes = append(changes, diffParams(old, new)...)
+	changes = append(changes, diffActions(old, new)...)
+	changes = append(changes, diffReferences(old, new)...)
+	return changes
+}
+
+// impact of a change on the roles of the old protocol, every role not in
+// broken is compatible
+func impact(old Protocol, broken ...Role) map[Role]Compatibility {
+	m := make(map[Role]Compatibility, len(old.Roles))
+	for _, r := range old.Roles {
+		m[r] = Compatible
+	}
+	for _, r := range broken {
+		if _, found := m[r]; found {
+			m[r] = Breaking
+		}
+	}
+	return m
+}
+
+func diffRoles(old, new Protocol) Changes {
+	changes := make(Changes, 0)
+	oldRoles := make(map[Role]bool, len(old.Roles))
+	for _, r := range old.Roles {
+		oldRoles[r] = true
+	}
+	newRoles := make(map[Role]bool, len(new.Roles))
+	for _, r := range new.Roles {
+		newRoles[r] = true
+		if !oldRoles[r] {
+			changes = append(changes, Change{Kind: Added, Element: RoleElement,
+				Name: string(r), Impact: impact(old)})
+		}
+	}
+	for _, r := range old.Roles {
+		if !newRoles[r] {
+			changes = append(changes, Change{Kind: Removed, Element: RoleElement,
+				Name: string(r), Impact: impact(old, r)})
+		}
+	}
+	return changes
+}
+
+func diffParams(old, new Protocol) Changes {
+	changes := make(Changes, 0)
+	oldParams := paramMap(old.Params)
+	newParams := paramMap(new.Params)
+	for _, n := range sortedNames(newParams) {
+		np := newParams[n]
+		op, found := oldParams[n]
+		if !found {
+			c := Change{Kind: Added, Element: ParamElement, Name: n, New: np.String()}
+			// instances can't be created without the new input
+			if np.Io == In || np.Key {
+				c.Impact = impact(old, old.Roles...)
+			} else {
+				c.Impact = impact(old)
+			}
+			changes = append(changes, c)
+		} else if op != np {
+			changes = append(changes, Change{Kind: Changed, Element: ParamElement, Name: n,
+				Old: op.String(), New: np.String(), Impact: impact(old, old.Roles...)})
+		}
+	}
+	for _, n := range sortedNames(oldParams) {
+		op := oldParams[n]
+		if _, found := newParams[n]; !found {
+			c := Change{Kind: Removed, Element: ParamElement, Name: n, Old: op.String()}
+			if op.Io == In || op.Key {
+				c.Impact = impact(old, old.Roles...)
+			} else {
+				c.Impact = impact(old)
+			}
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+func diffActions(old, new Protocol) Changes {
+	changes := make(Changes, 0)
+	oldActions := actionMap(old.Actions)
+	newActions := actionMap(new.Actions)
+	for _, sig := range sortedSignatures(newActions) {
+		na := newActions[sig]
+		oa, found := oldActions[sig]
+		if !found {
+			changes = append(changes, Change{Kind: Added, Element: ActionElement,
+				Name: sig, New: na.String(), Impact: impact(old, na.To)})
+			continue
+		}
+		changes = append(changes, diffActionParams(old, oa, na)...)
+	}
+	for _, sig := range sortedSignatures(oldActions) {
+		oa := oldActions[sig]
+		if _, found := newActions[sig]; !found {
+			changes = append(changes, Change{Kind: Removed, Element: ActionElement,
+				Name: sig, Old: oa.String(), Impact: impact(old, oa.From)})
+		}
+	}
+	return changes
+}
+
+func diffActionParams(old Protocol, oa, na Action) Changes {
+	changes := make(Changes, 0)
+	sig := signature(oa)
+	oldParams := paramMap(oa.Params)
+	newParams := paramMap(na.Params)
+	for _, n := range sortedNames(newParams) {
+		np := newParams[n]
+		op, found := oldParams[n]
+		if !found {
+			// a new obligation on the sender
+			changes = append(changes, Change{Kind: Added, Element: ActionParamElement,
+				Name: n, Action: sig, New: np.String(), Impact: impact(old, oa.From)})
+		} else if op != np {
+			broken := []Role{oa.From}
+			if op.Key != np.Key || op.Type != np.Type || op.Io != Nil && np.Io == Nil {
+				broken = append(broken, oa.To)
+			}
+			changes = append(changes, Change{Kind: Changed, Element: ActionParamElement,
+				Name: n, Action: sig, Old: op.String(), New: np.String(),
+				Impact: impact(old, broken...)})
+		}
+	}
+	for _, n := range sortedNames(oldParams) {
+		op := oldParams[n]
+		if _, found := newParams[n]; found {
+			continue
+		}
+		c := Change{Kind: Removed, Element: ActionParamElement, Name: n,
+			Action: sig, Old: op.String()}
+		// the recipient no longer learns the value
+		if op.Io != Nil {
+			c.Impact = impact(old, oa.To)
+		} else {
+			c.Impact = impact(old)
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+func diffReferences(old, new Protocol) Changes {
+	changes := make(Changes, 0)
+	for _, nr := range new.References {
+		or, found := old.Reference(nr.Name)
+		if !found {
+			changes = append(changes, Change{Kind: Added, Element: ReferenceElement,
+				Name: nr.Name, New: nr.String(), Impact: impact(old, nr.Roles...)})
+		} else if !reflect.DeepEqual(normalized(or), normalized(nr)) {
+			changes = append(changes, Change{Kind: Changed, Element: ReferenceElement,
+				Name: nr.Name, Old: or.String(), New: nr.String(),
+				Impact: impact(old, append(append([]Role(nil), or.Roles...), nr.Roles...)...)})
+		}
+	}
+	for _, or := range old.References {
+		if _, found := new.Reference(or.Name); !found {
+			changes = append(changes, Change{Kind: Removed, Element: ReferenceElement,
+				Name: or.Name, Old: or.String(), Impact: impact(old, or.Roles...)})
+		}
+	}
+	return changes
+}
+
+// normalized returns a copy of a reference with sorted parameters
+func normalized(r Reference) Reference {
+	r.Params = append([]Parameter(nil), r.Params...)
+	SortParameters(r.Params)
+	return r
+}
+
+// signature identifies an action across versions of a protocol
+func signature(a Action) string {
+	return fmt.Sprintf("%s -> %s: %s", a.From, a.To, a.Name)
+}
+
+func actionMap(acts []Action) map[string]Action {
+	m := make(map[string]Action, len(acts))
+	for _, a := range acts {
+		m[signature(a)] = a
+	}
+	return m
+}
+
+func paramMap(params []Parameter) map[string]Parameter {
+	m := make(map[string]Parameter, len(params))
+	for _, p := range params {
+		m[p.Name] = p
+	}
+	return m
+}
+
+func sortedNames(m map[string]Parameter) []string {
+	names := make([]string, 0, len(m))
+	for n := range m {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedSignatures(m map[string]Action) []string {
+	sigs := make([]string, 0, len(m))
+	for s := range m {
+		sigs = append(sigs, s)
+	}
+	sort.Strings(sigs)
+	return sigs
+}
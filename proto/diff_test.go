@@ -0,0 +1,115 @@
+package proto
+
+import (
+	"strings"
+	"testing"
+)
+
+func findChange(cs Changes, kind ChangeKind, e Element, name string) (Change, bool) {
+	for _, c := range cs {
+		if c.Kind == kind && c.Element == e && c.Name == name {
+			return c, true
+		}
+	}
+	return Change{}, false
+}
+
+func TestDiff_Same(t *testing.T) {
+	old := testProtocol()
+	new := testProtocol()
+	new.Actions[0], new.Actions[1] = new.Actions[1], new.Actions[0]
+	if cs := Diff(old, new); len(cs) != 0 || cs.Breaking() {
+		t.Fatal(cs)
+	}
+}
+
+func TestDiff_ActionParams(t *testing.T) {
+	old := testProtocol()
+	new := testProtocol()
+	// a new required in on an action the buyer sends
+	new.Params = append(new.Params, Parameter{Name: "address", Io: Out})
+	new.Actions[1].Params = append(new.Actions[1].Params, Parameter{Name: "address", Io: In})
+	// the seller no longer learns the item on Request
+	new.Actions[0].Params = new.Actions[0].Params[:1]
+	cs := Diff(old, new)
+	if len(cs) != 3 {
+		t.Fatal(cs)
+	}
+	if c, ok := findChange(cs, Added, ParamElement, "address"); !ok || c.Breaking() {
+		t.Fatal(c)
+	}
+	c, ok := findChange(cs, Added, ActionParamElement, "address")
+	if !ok || c.Action != "Buyer -> Seller: Offer" ||
+		c.Impact["Buyer"] != Breaking || c.Impact["Seller"] != Compatible {
+		t.Fatal(c)
+	}
+	c, ok = findChange(cs, Removed, ActionParamElement, "item")
+	if !ok || c.Impact["Buyer"] != Compatible || c.Impact["Seller"] != Breaking {
+		t.Fatal(c)
+	}
+	if len(cs.For("Buyer")) != 1 || len(cs.For("Seller")) != 1 || !cs.Breaking() {
+		t.Fatal(cs)
+	}
+	if !strings.HasSuffix(c.String(), "(breaking for Seller)") {
+		t.Fatal(c.String())
+	}
+}
+
+func TestDiff_Elements(t *testing.T) {
+	old := testProtocol()
+	new := testProtocol()
+	new.Roles = append(new.Roles, "Shipper")
+	new.Params[2].Type = Decimal
+	new.Actions = append(new.Actions[:1], Action{Name: "Ship", From: "Seller", To: "Shipper",
+		Params: []Parameter{{Name: "ID", Key: true, Io: In}}})
+	cs := Diff(old, new)
+	if c, ok := findChange(cs, Added, RoleElement, "Shipper"); !ok || c.Breaking() {
+		t.Fatal(c)
+	}
+	c, ok := findChange(cs, Changed, ParamElement, "price")
+	if !ok || c.Old != "out price" || c.New != "out price: decimal" || len(c.BreakingRoles()) != 2 {
+		t.Fatal(c)
+	}
+	// the new recipient has no agents built on the old version
+	if c, ok := findChange(cs, Added, ActionElement, "Seller -> Shipper: Ship"); !ok || c.Breaking() {
+		t.Fatal(c)
+	}
+	c, ok = findChange(cs, Removed, ActionElement, "Buyer -> Seller: Offer")
+	if !ok || c.Impact["Buyer"] != Breaking || c.Impact["Seller"] != Compatible {
+		t.Fatal(c)
+	}
+	// removing a role breaks it
+	new = testProtocol()
+	new.Roles = new.Roles[:1]
+	if c, ok := findChange(Diff(old, new), Removed, RoleElement, "Seller"); !ok ||
+		c.Impact["Seller"] != Breaking || c.Impact["Buyer"] != Compatible {
+		t.Fatal(c)
+	}
+}
+
+func TestDiff_References(t *testing.T) {
+	old, _ := testComposite()
+	new, _ := testComposite()
+	new.References[0].Params[0], new.References[0].Params[1] = new.References[0].Params[1], new.References[0].Params[0]
+	if cs := Diff(old, new); len(cs) != 0 {
+		t.Fatal(cs)
+	}
+	new.References[0].Params = new.References[0].Params[1:]
+	c, ok := findChange(Diff(old, new), Changed, ReferenceElement, "Payment")
+	if !ok || len(c.BreakingRoles()) != 2 {
+		t.Fatal(c)
+	}
+	// the roles of the old reference have spare capacity that must not be
+	// written
+	roles := make([]Role, len(old.References[0].Roles), len(old.References[0].Roles)+2)
+	copy(roles, old.References[0].Roles)
+	old.References[0].Roles = roles
+	Diff(old, new)
+	if spare := roles[:cap(roles)]; spare[len(roles)] != "" {
+		t.Fatalf("Diff wrote the roles of the old protocol: %v", spare)
+	}
+	new.References = nil
+	if c, ok := findChange(Diff(old, new), Removed, ReferenceElement, "Payment"); !ok || !c.Breaking() {
+		t.Fatal(c)
+	}
+}
@@ -1,12 +1,217 @@
 package proto
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
-// ValidationError is created while validating protocols
+// IssueCode identifies the kind of a validation issue. Codes are errors so
+// they can be matched with errors.Is, e.g. errors.Is(err, proto.Cycle).
+type IssueCode string
+
+const (
+	// NoKeyParams is found when a protocol has no key parameters
+	NoKeyParams IssueCode = "NoKeyParams"
+	// UnknownType is found when a parameter has an unknown type
+	UnknownType IssueCode = "UnknownType"
+	// TypeMismatch is found when an action parameter and the protocol
+	// parameter with the same name have different types
+	TypeMismatch IssueCode = "TypeMismatch"
+	// UnknownRole is found when an action is sent or received by a role
+	// that isn't declared in the protocol
+	UnknownRole IssueCode = "UnknownRole"
+	// NoSharedKey is found when an action has no key parameter of the
+	// protocol
+	NoSharedKey IssueCode = "NoSharedKey"
+	// IncompleteKey is found when an action extends the key of the
+	// protocol without including all of it
+	IncompleteKey IssueCode = "IncompleteKey"
+	// Cycle is found when actions depend on each other
+	Cycle IssueCode = "Cycle"
+	// UndeclaredParam is found when an action uses a parameter that isn't
+	// declared in the protocol
+	UndeclaredParam IssueCode = "UndeclaredParam"
+	// AdornmentMismatch is found when an action binds a parameter the
+	// protocol declares 'in' or 'nil', or needs a parameter the protocol
+	// declares 'nil'
+	AdornmentMismatch IssueCode = "AdornmentMismatch"
+	// UnknownProtocol is found when a composite protocol references a
+	// protocol that can't be found
+	UnknownProtocol IssueCode = "UnknownProtocol"
+	// ReferenceMismatch is found when a reference doesn't agree with the
+	// roles and parameters of the protocol it references
+	ReferenceMismatch IssueCode = "ReferenceMismatch"
+	// UnproducedParam is found when no action outputs an 'out' parameter of
+	// the protocol, so it can never be completed
+	UnproducedParam IssueCode = "UnproducedParam"
+)
+
+func (c IssueCode) Error() string {
+	return string(c)
+}
+
+// Check of the validation that found an issue
+type Check string
+
+const (
+	// KeyCheck checks the key parameters of the protocol and its actions
+	KeyCheck Check = "keys"
+	// TypeCheck checks the types of the parameters
+	TypeCheck Check = "types"
+	// RoleCheck checks the roles of the actions
+	RoleCheck Check = "roles"
+	// DependencyCheck checks the dependencies between actions
+	DependencyCheck Check = "dependencies"
+	// CompositionCheck checks the references of composite protocols
+	CompositionCheck Check = "composition"
+	// InterfaceCheck checks that the actions agree with the parameters
+	// declared by the protocol, its issues are warnings in lenient mode
+	InterfaceCheck Check = "interface"
+)
+
+// Severity of an issue
+type Severity string
+
+const (
+	// Error issues make a protocol invalid
+	Error Severity = "error"
+	// Warning issues are accepted by lenient validation, see Warnings
+	Warning Severity = "warning"
+)
+
+// Issue found while validating a protocol
+type Issue struct {
+	Code     IssueCode `json:"code"`
+	Check    Check     `json:"check"`
+	Severity Severity  `json:"severity"`
+	// Names of the offending actions, roles and parameters
+	Actions []string `json:"actions,omitempty"`
+	Roles   []Role   `json:"roles,omitempty"`
+	Params  []string `json:"parameters,omitempty"`
+	Message string   `json:"message"`
+}
+
+func (i Issue) Error() string {
+	return i.Message
+}
+
+// Is matches issues with the same code as an IssueCode or Issue
+func (i Issue) Is(target error) bool {
+	switch t := target.(type) {
+	case IssueCode:
+		return i.Code == t
+	case Issue:
+		return i.Code == t.Code
+	}
+	return false
+}
+
+// ValidationError is created while validating protocols, it lists every
+// issue found. errors.Is matches any of them, but errors.As only sees the
+// first one: use Issues or Find to inspect all of them, e.g.
+//
+//	var ve proto.ValidationError
+//	if errors.As(err, &ve) {
+//		for _, issue := range ve.Find(proto.Cycle) {
+//			...
+//		}
+//	}
 type ValidationError struct {
-	Err error
+	Issues []Issue
 }
 
 func (e ValidationError) Error() string {
-	return fmt.Sprintf("Validation error: \"%s\"", e.Err.Error())
+	msgs := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		msgs[i] = fmt.Sprintf("\"%s\"", issue.Error())
+	}
+	return "Validation error: " + strings.Join(msgs, "; ")
+}
+
+// Find returns the issues with a code
+func (e ValidationError) Find(code IssueCode) []Issue {
+	found := make([]Issue, 0)
+	for _, issue := range e.Issues {
+		if issue.Code == code {
+			found = append(found, issue)
+		}
+	}
+	return found
+}
+
+// Is returns true if any issue matches the target
+func (e ValidationError) Is(target error) bool {
+	for _, issue := range e.Issues {
+		if issue.Is(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As sets an *Issue target to the first issue. The other issues are only
+// available through Issues and Find.
+func (e ValidationError) As(target interface{}) bool {
+	if t, ok := target.(*Issue); ok && len(e.Issues) > 0 {
+		*t = e.Issues[0]
+		return true
+	}
+	return false
+}
+
+// TypeError is returned when a value doesn't belong to the type of
+// a parameter
+type TypeError struct {
+	Type  Type
+	Value string
+}
+
+func (e TypeError) Error() string {
+	return fmt.Sprintf("'%s' is not a valid %s", e.Value, e.Type)
+}
+
+// InterchangeError is returned when decoding an invalid JSON or YAML
+// protocol
+type InterchangeError struct {
+	Err error
+}
+
+func (e InterchangeError) Error() string {
+	return fmt.Sprintf("Interchange error: \"%s\"", e.Err.Error())
+}
+
+// BuildError is returned by Builder.Build with every error found while
+// building a protocol
+type BuildError struct {
+	Errs []error
+}
+
+func (e BuildError) Error() string {
+	var s strings.Builder
+	s.WriteString("Build error:")
+	for _, err := range e.Errs {
+		s.WriteString(" \"" + err.Error() + "\";")
+	}
+	return strings.TrimSuffix(s.String(), ";")
+}
+
+// Is returns true if any of the errors matches the target
+func (e BuildError) Is(target error) bool {
+	for _, err := range e.Errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error that matches the target
+func (e BuildError) As(target interface{}) bool {
+	for _, err := range e.Errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
 }
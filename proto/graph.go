@@ -0,0 +1,47 @@
+package proto
+
+// Dependency states that an action can't be run before another one
+// has outputted some of its 'in' parameters
+type Dependency struct {
+	Action    Action
+	DependsOn Action
+	Params    []Parameter
+}
+
+// Graph returns the dependencies between the actions of the protocol
+func (p Protocol) Graph() []Dependency {
+	deps := make([]Dependency, 0)
+	for _, l := range createLinkedActions(p.Actions) {
+		for _, d := range l.dependsOn {
+			deps = append(deps, Dependency{
+				Action:    l.action,
+				DependsOn: d.action,
+				Params:    intersection(l.action.Ins(), d.action.Outs()),
+			})
+		}
+	}
+	return deps
+}
+
+// Producers returns the actions that output a parameter
+func (p Protocol) Producers(param string) []Action {
+	return p.actionsWith(param, Out)
+}
+
+// Consumers returns the actions that take a parameter as an input
+func (p Protocol) Consumers(param string) []Action {
+	return p.actionsWith(param, In)
+}
+
+func (p Protocol) actionsWith(param string, io IO) []Action {
+	acts := make([]Action, 0)
+	for _, a := range p.Actions {
+		for _, x := range a.Params {
+			if x.Name == param && x.Io == io {
+				acts = append(acts, a)
+				break
+			}
+		}
+	}
+	return acts
+}
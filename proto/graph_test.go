@@ -0,0 +1,34 @@
+package proto
+
+import (
+	"testing"
+)
+
+func TestProtocol_Graph(t *testing.T) {
+	p := testProtocol()
+	request, offer := p.Actions[0], p.Actions[1]
+	graph := p.Graph()
+	if len(graph) != 1 {
+		t.FailNow()
+	}
+	d := graph[0]
+	if d.Action.Name != offer.Name || d.DependsOn.Name != request.Name {
+		t.FailNow()
+	}
+	if len(d.Params) != 2 {
+		t.Fatalf("Unexpected parameters: %v", d.Params)
+	}
+}
+
+func TestProtocol_ProducersAndConsumers(t *testing.T) {
+	p := testProtocol()
+	if producers := p.Producers("item"); len(producers) != 1 || producers[0].Name != "Request" {
+		t.FailNow()
+	}
+	if consumers := p.Consumers("item"); len(consumers) != 1 || consumers[0].Name != "Offer" {
+		t.FailNow()
+	}
+	if len(p.Consumers("price")) != 0 {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,41 @@
+package proto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Clone returns a deep copy of the protocol
+func (p Protocol) Clone() Protocol {
+	c := Protocol{Name: p.Name}
+	c.Roles = append([]Role(nil), p.Roles...)
+	c.Params = append([]Parameter(nil), p.Params...)
+	c.Actions = make([]Action, len(p.Actions))
+	for i, a := range p.Actions {
+		a.Params = append([]Parameter(nil), a.Params...)
+		c.Actions[i] = a
+	}
+	if p.References != nil {
+		c.References = make([]Reference, len(p.References))
+		for i, r := range p.References {
+			r.Roles = append([]Role(nil), r.Roles...)
+			r.Params = append([]Parameter(nil), r.Params...)
+			c.References[i] = r
+		}
+	}
+	return c
+}
+
+// Hash returns the hex SHA-256 of the canonical form of the protocol:
+// its sorted JSON representation. Protocols that only differ in the
+// order of their elements other than roles have the same hash, the order
+// of the roles matters to the references to the protocol.
+func (p Protocol) Hash() string {
+	c := p.Clone()
+	c.Sort()
+	// encoding a protocol can't fail
+	data, _ := json.Marshal(c)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
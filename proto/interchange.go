@@ -0,0 +1,226 @@
+package proto
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// protocolDoc is the JSON and YAML representation of a Protocol, see
+// schema/protocol.schema.json
+type protocolDoc struct {
+	Name    string      `json:"name" yaml:"name"`
+	Roles   []Role      `json:"roles" yaml:"roles"`
+	Params  []paramDoc  `json:"parameters" yaml:"parameters"`
+	Actions []actionDoc `json:"actions" yaml:"actions"`
+	// References of composite protocols
+	References []referenceDoc `json:"references,omitempty" yaml:"references,omitempty"`
+}
+
+// paramDoc is the JSON and YAML representation of a Parameter
+type paramDoc struct {
+	Name string `json:"name" yaml:"name"`
+	Io   IO     `json:"io" yaml:"io"`
+	Key  bool   `json:"key,omitempty" yaml:"key,omitempty"`
+	Type Type   `json:"type,omitempty" yaml:"type,omitempty"`
+}
+
+// actionDoc is the JSON and YAML representation of an Action
+type actionDoc struct {
+	Name   string     `json:"name" yaml:"name"`
+	From   Role       `json:"from" yaml:"from"`
+	To     Role       `json:"to" yaml:"to"`
+	Params []paramDoc `json:"parameters" yaml:"parameters"`
+}
+
+// referenceDoc is the JSON and YAML representation of a Reference
+type referenceDoc struct {
+	Name   string     `json:"name" yaml:"name"`
+	Roles  []Role     `json:"roles" yaml:"roles"`
+	Params []paramDoc `json:"parameters" yaml:"parameters"`
+}
+
+func newParamDocs(params []Parameter) []paramDoc {
+	docs := make([]paramDoc, len(params))
+	for i, p := range params {
+		docs[i] = paramDoc{Name: p.Name, Io: p.Io, Key: p.Key, Type: p.Type}
+	}
+	return docs
+}
+
+func newActionDoc(a Action) actionDoc {
+	return actionDoc{Name: a.Name, From: a.From, To: a.To, Params: newParamDocs(a.Params)}
+}
+
+func newProtocolDoc(p Protocol) protocolDoc {
+	doc := protocolDoc{Name: p.Name, Roles: p.Roles, Params: newParamDocs(p.Params)}
+	if doc.Roles == nil {
+		doc.Roles = []Role{}
+	}
+	doc.Actions = make([]actionDoc, len(p.Actions))
+	for i, a := range p.Actions {
+		doc.Actions[i] = newActionDoc(a)
+	}
+	for _, r := range p.References {
+		doc.References = append(doc.References,
+			referenceDoc{Name: r.Name, Roles: r.Roles, Params: newParamDocs(r.Params)})
+	}
+	return doc
+}
+
+func (d paramDoc) parameter() (Parameter, error) {
+	if d.Name == "" {
+		return Parameter{}, InterchangeError{Err: fmt.Errorf("Parameter without name")}
+	}
+	switch d.Io {
+	case In, Out, Nil:
+	default:
+		return Parameter{}, InterchangeError{Err: fmt.Errorf(
+			"Invalid io of parameter '%s': '%s'", d.Name, d.Io)}
+	}
+	if !d.Type.Valid() {
+		return Parameter{}, InterchangeError{Err: fmt.Errorf(
+			"Unknown type of parameter '%s': %s", d.Name, d.Type)}
+	}
+	return Parameter{Io: d.Io, Key: d.Key, Name: d.Name, Type: d.Type}, nil
+}
+
+func decodeParams(docs []paramDoc) ([]Parameter, error) {
+	params := make([]Parameter, len(docs))
+	for i, d := range docs {
+		p, err := d.parameter()
+		if err != nil {
+			return nil, err
+		}
+		params[i] = p
+	}
+	return params, nil
+}
+
+func (d actionDoc) action() (Action, error) {
+	if d.Name == "" || d.From == "" || d.To == "" {
+		return Action{}, InterchangeError{Err: fmt.Errorf(
+			"Action '%s' requires a name and both roles", d.Name)}
+	}
+	params, err := decodeParams(d.Params)
+	if err != nil {
+		return Action{}, err
+	}
+	return Action{Name: d.Name, From: d.From, To: d.To, Params: params}, nil
+}
+
+func (d protocolDoc) protocol() (Protocol, error) {
+	if d.Name == "" {
+		return Protocol{}, InterchangeError{Err: fmt.Errorf("Protocol without name")}
+	}
+	params, err := decodeParams(d.Params)
+	if err != nil {
+		return Protocol{}, err
+	}
+	p := Protocol{Name: d.Name, Roles: d.Roles, Params: params, Actions: make([]Action, len(d.Actions))}
+	if p.Roles == nil {
+		p.Roles = []Role{}
+	}
+	for i, ad := range d.Actions {
+		if p.Actions[i], err = ad.action(); err != nil {
+			return Protocol{}, err
+		}
+	}
+	for _, rd := range d.References {
+		r, err := rd.reference()
+		if err != nil {
+			return Protocol{}, err
+		}
+		p.References = append(p.References, r)
+	}
+	return p, nil
+}
+
+func (d referenceDoc) reference() (Reference, error) {
+	if d.Name == "" || len(d.Roles) == 0 {
+		return Reference{}, InterchangeError{Err: fmt.Errorf(
+			"Reference '%s' requires a name and roles", d.Name)}
+	}
+	params, err := decodeParams(d.Params)
+	if err != nil {
+		return Reference{}, err
+	}
+	return Reference{Name: d.Name, Roles: d.Roles, Params: params}, nil
+}
+
+// MarshalJSON encodes a Parameter as {"name", "io", "key", "type"}
+func (p Parameter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newParamDocs([]Parameter{p})[0])
+}
+
+// UnmarshalJSON decodes a Parameter, see MarshalJSON
+func (p *Parameter) UnmarshalJSON(data []byte) error {
+	var d paramDoc
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+	param, err := d.parameter()
+	if err != nil {
+		return err
+	}
+	*p = param
+	return nil
+}
+
+// MarshalJSON encodes an Action as {"name", "from", "to", "parameters"}
+func (a Action) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newActionDoc(a))
+}
+
+// UnmarshalJSON decodes an Action, see MarshalJSON
+func (a *Action) UnmarshalJSON(data []byte) error {
+	var d actionDoc
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+	action, err := d.action()
+	if err != nil {
+		return err
+	}
+	*a = action
+	return nil
+}
+
+// MarshalJSON encodes a Protocol as {"name", "roles", "parameters",
+// "actions", "references"}, following schema/protocol.schema.json
+func (p Protocol) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newProtocolDoc(p))
+}
+
+// UnmarshalJSON decodes a Protocol, see MarshalJSON. The protocol is
+// kept in the order it was encoded and is not validated.
+func (p *Protocol) UnmarshalJSON(data []byte) error {
+	var d protocolDoc
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+	protocol, err := d.protocol()
+	if err != nil {
+		return err
+	}
+	*p = protocol
+	return nil
+}
+
+// MarshalYAML encodes a Protocol with the same structure as MarshalJSON
+func (p Protocol) MarshalYAML() (interface{}, error) {
+	return newProtocolDoc(p), nil
+}
+
+// UnmarshalYAML decodes a Protocol, see MarshalYAML
+func (p *Protocol) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var d protocolDoc
+	if err := unmarshal(&d); err != nil {
+		return err
+	}
+	protocol, err := d.protocol()
+	if err != nil {
+		return err
+	}
+	*p = protocol
+	return nil
+}
@@ -0,0 +1,105 @@
+package proto
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func testTypedProtocol() Protocol {
+	p := testProtocol()
+	p.Params[2].Type = Decimal
+	p.Params = append(p.Params, Parameter{Name: "note", Io: Nil})
+	return p
+}
+
+func TestProtocol_JSON(t *testing.T) {
+	p := testTypedProtocol()
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`"name":"ProtoName"`,
+		`{"name":"ID","io":"out","key":true}`,
+		`{"name":"price","io":"out","type":"decimal"}`,
+		`"from":"Buyer","to":"Seller"`,
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Fatalf("Missing '%s' in %s", expected, data)
+		}
+	}
+	var decoded Protocol
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, decoded) {
+		t.Fatalf("Expected %v, got %v", p, decoded)
+	}
+}
+
+func TestProtocol_YAML(t *testing.T) {
+	p := testTypedProtocol()
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "io: out") {
+		t.Fatal(string(data))
+	}
+	var decoded Protocol
+	if err := yaml.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, decoded) {
+		t.Fatalf("Expected %v, got %v", p, decoded)
+	}
+}
+
+func TestProtocol_UnmarshalJSONErrors(t *testing.T) {
+	docs := []string{
+		`{"roles": [], "parameters": [], "actions": []}`,
+		`{"name": "P", "parameters": [{"name": "ID", "io": "inout"}]}`,
+		`{"name": "P", "parameters": [{"name": "ID", "io": "out", "type": "money"}]}`,
+		`{"name": "P", "parameters": [{"io": "out"}]}`,
+		`{"name": "P", "actions": [{"name": "A", "from": "B"}]}`,
+		`{"name": 1}`,
+	}
+	for _, doc := range docs {
+		var p Protocol
+		if err := json.Unmarshal([]byte(doc), &p); err == nil {
+			t.Errorf("Decoded invalid protocol: %s", doc)
+		}
+	}
+}
+
+func TestSchema(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("..", "schema", "protocol.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Required    []string                               `json:"required"`
+		Definitions map[string]struct{ Required []string } `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	// the required fields of the schema are always encoded
+	encoded := make(map[string]interface{})
+	b, _ := json.Marshal(Protocol{Name: "P"})
+	json.Unmarshal(b, &encoded)
+	for _, field := range schema.Required {
+		if _, found := encoded[field]; !found {
+			t.Errorf("Required field '%s' not encoded", field)
+		}
+	}
+	if len(schema.Definitions["parameter"].Required) != 2 {
+		t.Fatal("Unexpected required fields of parameters")
+	}
+}
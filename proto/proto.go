@@ -1,6 +1,7 @@
 package proto
 
 import (
+	"sort"
 	"strings"
 )
 
@@ -22,6 +23,7 @@ type Parameter struct {
 	Io   IO
 	Key  bool
 	Name string
+	Type Type
 }
 
 // Protocol is a definition of a BSPQL protocol
@@ -30,6 +32,8 @@ type Protocol struct {
 	Name    string
 	Roles   []Role
 	Params  []Parameter
+	// References to the protocols enacted as steps of a composite protocol
+	References []Reference
 }
 
 // Parameters of a Protocol
@@ -69,14 +73,18 @@ func (p Protocol) Key() string {
 	return sb.String()
 }
 
-// Sort all elements of a protocol
+// Sort the elements of a protocol. Roles keep the order they are declared
+// in, which references rely on, see Reference.
 func (p *Protocol) Sort() {
-	SortRoles(p.Roles)
 	SortParameters(p.Params)
 	for _, a := range p.Actions {
 		SortParameters(a.Params)
 	}
 	SortActions(p.Actions)
+	for _, r := range p.References {
+		SortParameters(r.Params)
+	}
+	SortReferences(p.References)
 }
 
 func (a Action) String() string {
@@ -101,6 +109,9 @@ func (p Parameter) String() string {
 	if p.Key {
 		s.WriteString(" key")
 	}
+	if p.Type != Untyped {
+		s.WriteString(": " + string(p.Type))
+	}
 	return s.String()
 }
 
@@ -119,6 +130,9 @@ func (p Protocol) String() string {
 	for _, a := range p.Actions {
 		s.WriteString("\t" + a.String() + "\n")
 	}
+	for _, r := range p.References {
+		s.WriteString("\t" + r.String() + "\n")
+	}
 	s.WriteString("}")
 	return s.String()
 }
@@ -198,11 +212,48 @@ func (p Protocol) Nils() []Parameter {
 	return findNils(p.Params)
 }
 
+// Undeclared returns the names of the parameters used by the actions and
+// references of the protocol that the protocol doesn't declare, sorted.
+// Lenient validation accepts them, see CheckInterface.
+func (p Protocol) Undeclared() []string {
+	found := make(map[string]bool)
+	names := make([]string, 0)
+	for _, a := range p.steps() {
+		for _, param := range a.Params {
+			if _, declared := p.Param(param.Name); !declared && !found[param.Name] {
+				found[param.Name] = true
+				names = append(names, param.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Keys returns a list of the key parameters of the action
 func (a Action) Keys() []Parameter {
 	return findKeys(a.Parameters())
 }
 
+// ExtendedKey returns the key parameters of an action that aren't key
+// parameters of the protocol, sorted by name. An action with an extended
+// key can run once for each tuple of values of its key, e.g. once for
+// each item of an order.
+func (p Protocol) ExtendedKey(a Action) []Parameter {
+	protocolKeys := make(map[string]bool)
+	for _, k := range p.Keys() {
+		protocolKeys[k.Name] = true
+	}
+	extended := make([]Parameter, 0)
+	for _, k := range a.Keys() {
+		if !protocolKeys[k.Name] {
+			extended = append(extended, k)
+		}
+	}
+	sort.Slice(extended, func(i, j int) bool { return extended[i].Name < extended[j].Name })
+	return extended
+}
+
 // Ins returns a list of the implicit parameters of the action
 func (a Action) Ins() []Parameter {
 	return findIns(a.Params)
@@ -23,3 +23,78 @@ func TestProtocol_Dependencies(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestProtocol_Hash(t *testing.T) {
+	p := testProtocol()
+	hash := p.Hash()
+	if len(hash) != 64 {
+		t.Fatal(hash)
+	}
+	// order doesn't matter and the protocol is not modified
+	q := testProtocol()
+	q.Actions[0], q.Actions[1] = q.Actions[1], q.Actions[0]
+	q.Params[0], q.Params[1] = q.Params[1], q.Params[0]
+	if q.Hash() != hash {
+		t.Fatal("Hash depends on order")
+	}
+	if q.Actions[0].Name != "Offer" || q.Params[1].Name != "ID" {
+		t.Fatal("Hash modified the protocol")
+	}
+	// except for roles, which references bind by position
+	r := testProtocol()
+	r.Roles[0], r.Roles[1] = r.Roles[1], r.Roles[0]
+	if r.Hash() == hash {
+		t.Fatal("Hash doesn't depend on the order of the roles")
+	}
+	// same name and key, different content
+	q.Params[2].Type = Decimal
+	if q.Key() != p.Key() || q.Hash() == hash {
+		t.Fatal("Different protocols have the same hash")
+	}
+}
+
+func TestProtocol_ExtendedKey(t *testing.T) {
+	p, err := NewBuilder("Order").
+		Roles("Buyer", "Seller").
+		Param(OutParam("ID").AsKey(), OutParam("itemNo").Typed(Int), OutParam("item")).
+		Action("Buyer", "Seller", "Open", OutParam("ID").AsKey()).
+		Action("Buyer", "Seller", "AddItem", InParam("ID").AsKey(), OutParam("itemNo").AsKey(),
+			OutParam("item")).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sorted actions: AddItem, Open
+	add, open := p.Actions[0], p.Actions[1]
+	if open.Name != "Open" || len(p.ExtendedKey(open)) != 0 {
+		t.Fatalf("Unexpected extended key of %s", open)
+	}
+	if ext := p.ExtendedKey(add); len(ext) != 1 || ext[0].Name != "itemNo" {
+		t.Fatalf("Unexpected extended key of %s: %v", add, ext)
+	}
+	// a key of two parameters extended without one of them
+	p.Params = append(p.Params, OutParam("shop").AsKey())
+	p.Actions[1].Params = append(p.Actions[1].Params, OutParam("shop").AsKey())
+	err = Validate(p)
+	ve, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("Expected a ValidationError, found %v", err)
+	}
+	issues := ve.Find(IncompleteKey)
+	if len(issues) != 1 || issues[0].Actions[0] != "AddItem" || issues[0].Params[0] != "shop" {
+		t.Fatalf("Unexpected issues: %v", ve.Issues)
+	}
+}
+
+func TestProtocol_Undeclared(t *testing.T) {
+	p := testProtocol()
+	if undeclared := p.Undeclared(); len(undeclared) != 0 {
+		t.Fatalf("Unexpected undeclared parameters: %v", undeclared)
+	}
+	p.Actions[1].Params = append(p.Actions[1].Params, OutParam("note"))
+	p.Actions[0].Params = append(p.Actions[0].Params, OutParam("address"), InParam("note"))
+	if undeclared := p.Undeclared(); len(undeclared) != 2 || undeclared[0] != "address" ||
+		undeclared[1] != "note" {
+		t.Fatalf("Unexpected undeclared parameters: %v", undeclared)
+	}
+}
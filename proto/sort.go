@@ -97,3 +97,10 @@ func SortActions(acts []Action) {
 func SortRoles(rols []Role) {
 	sort.Sort(roles(rols))
 }
+
+// SortReferences sorts references alphabetically
+func SortReferences(refs []Reference) {
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].String() < refs[j].String()
+	})
+}
@@ -0,0 +1,207 @@
+package proto
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+// Type of the values of a parameter
+type Type string
+
+const (
+	// Untyped parameters accept any value
+	Untyped Type = ""
+	// String values
+	String Type = "string"
+	// Int values are base 10 signed 64-bit integers
+	Int Type = "int"
+	// Decimal values are base 10 numbers of arbitrary precision, e.g. "10.25"
+	Decimal Type = "decimal"
+	// Bool values are "true" or "false"
+	Bool Type = "bool"
+	// Time values are RFC 3339 timestamps
+	Time Type = "time"
+)
+
+// Types contains every known parameter type
+var Types = []Type{String, Int, Decimal, Bool, Time}
+
+// Valid returns true if the type is known
+func (t Type) Valid() bool {
+	if t == Untyped {
+		return true
+	}
+	for _, x := range Types {
+		if t == x {
+			return true
+		}
+	}
+	return false
+}
+
+// Check that a value belongs to the type
+func (t Type) Check(value string) error {
+	var err error
+	switch t {
+	case Untyped, String:
+		return nil
+	case Int:
+		_, err = ParseInt(value)
+	case Decimal:
+		_, err = ParseDecimal(value)
+	case Bool:
+		_, err = ParseBool(value)
+	case Time:
+		_, err = ParseTime(value)
+	default:
+		return fmt.Errorf("Unknown type: %s", t)
+	}
+	return err
+}
+
+// Equal returns true if two values of the type are the same, e.g. the
+// decimals "1.50" and "1.5". Values that don't belong to the type are only
+// equal to themselves.
+func (t Type) Equal(a, b string) bool {
+	if a == b {
+		return true
+	}
+	switch t {
+	case Int:
+		x, errX := ParseInt(a)
+		y, errY := ParseInt(b)
+		return errX == nil && errY == nil && x == y
+	case Decimal:
+		x, errX := ParseDecimal(a)
+		y, errY := ParseDecimal(b)
+		return errX == nil && errY == nil && x.Cmp(y) == 0
+	case Time:
+		x, errX := ParseTime(a)
+		y, errY := ParseTime(b)
+		return errX == nil && errY == nil && x.Equal(y)
+	}
+	return false
+}
+
+// ParseInt parses the value of an int parameter
+func ParseInt(value string) (int64, error) {
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, TypeError{Type: Int, Value: value}
+	}
+	return i, nil
+}
+
+// ParseDecimal parses the value of a decimal parameter
+func ParseDecimal(value string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(value)
+	// big.Rat also accepts fractions such as "1/3"
+	if !ok || !isDecimal(value) {
+		return nil, TypeError{Type: Decimal, Value: value}
+	}
+	return r, nil
+}
+
+// ParseBool parses the value of a bool parameter
+func ParseBool(value string) (bool, error) {
+	switch value {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, TypeError{Type: Bool, Value: value}
+}
+
+// ParseTime parses the value of a time parameter
+func ParseTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, TypeError{Type: Time, Value: value}
+	}
+	return t, nil
+}
+
+// FormatInt formats the value of an int parameter
+func FormatInt(i int64) string {
+	return strconv.FormatInt(i, 10)
+}
+
+// FormatDecimal formats the value of a decimal parameter exactly. Numbers
+// without a finite decimal expansion, e.g. 1/3, are formatted as
+// fractions, which are not valid decimal values.
+func FormatDecimal(r *big.Rat) string {
+	// a fraction has a finite decimal expansion if its denominator only
+	// has 2 and 5 as prime factors
+	d := new(big.Int).Set(r.Denom())
+	digits := 0
+	for _, f := range []*big.Int{big.NewInt(2), big.NewInt(5)} {
+		q, m := new(big.Int), new(big.Int)
+		for n := 1; ; n++ {
+			if q.QuoRem(d, f, m); m.Sign() != 0 {
+				break
+			}
+			d.Set(q)
+			if n > digits {
+				digits = n
+			}
+		}
+	}
+	if !d.IsInt64() || d.Int64() != 1 {
+		return r.RatString()
+	}
+	return r.FloatString(digits)
+}
+
+// FormatBool formats the value of a bool parameter
+func FormatBool(b bool) string {
+	return strconv.FormatBool(b)
+}
+
+// FormatTime formats the value of a time parameter
+func FormatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+// isDecimal returns true if value is an optionally signed number with an
+// optional fractional part
+func isDecimal(value string) bool {
+	digits, dot := 0, false
+	for i, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '.' && !dot:
+			dot = true
+		case (r == '-' || r == '+') && i == 0:
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+// Param returns the protocol-level declaration of a parameter
+func (p Protocol) Param(name string) (Parameter, bool) {
+	for _, param := range p.Params {
+		if param.Name == name {
+			return param, true
+		}
+	}
+	return Parameter{}, false
+}
+
+// CheckValue checks a value against the type declared for a parameter.
+// Undeclared and untyped parameters accept any value.
+func (p Protocol) CheckValue(name string, value string) error {
+	param, found := p.Param(name)
+	if !found {
+		return nil
+	}
+	if err := param.Type.Check(value); err != nil {
+		return fmt.Errorf("Invalid value for '%s': %s", name, err)
+	}
+	return nil
+}
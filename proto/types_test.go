@@ -0,0 +1,87 @@
+package proto
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestType_Check(t *testing.T) {
+	valid := map[Type][]string{
+		Untyped: {"", "anything"},
+		String:  {"", "anything"},
+		Int:     {"0", "-12", "9223372036854775807"},
+		Decimal: {"1", "-1.5", "0.25", "+3."},
+		Bool:    {"true", "false"},
+		Time:    {"2020-04-01T10:00:00Z", "2020-04-01T10:00:00+02:00"},
+	}
+	invalid := map[Type][]string{
+		Int:     {"", "1.5", "one", "9223372036854775808"},
+		Decimal: {"", "1/3", "1e3", "1.2.3", "-"},
+		Bool:    {"", "True", "1"},
+		Time:    {"", "2020-04-01", "yesterday"},
+		"money": {"1"},
+	}
+	for typ, values := range valid {
+		for _, v := range values {
+			if err := typ.Check(v); err != nil {
+				t.Errorf("'%s' rejected as %s: %s", v, typ, err)
+			}
+		}
+	}
+	for typ, values := range invalid {
+		for _, v := range values {
+			if err := typ.Check(v); err == nil {
+				t.Errorf("'%s' accepted as %s", v, typ)
+			}
+		}
+	}
+}
+
+func TestParameter_String(t *testing.T) {
+	p := Parameter{Name: "ID", Key: true, Io: Out, Type: Int}
+	if p.String() != "out ID key: int" {
+		t.Fatal(p.String())
+	}
+}
+
+func TestProtocol_CheckValue(t *testing.T) {
+	p := testProtocol()
+	p.Params[2].Type = Decimal
+	if err := p.CheckValue("price", "10.5"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.CheckValue("price", "ten"); err == nil {
+		t.FailNow()
+	}
+	if err := p.CheckValue("undeclared", "ten"); err != nil {
+		t.FailNow()
+	}
+}
+
+func TestFormatDecimal(t *testing.T) {
+	for value, expected := range map[string]string{
+		"10": "10", "-1.50": "-1.5", "0.125": "0.125", "2.5": "2.5", "1/3": "1/3",
+	} {
+		r, _ := new(big.Rat).SetString(value)
+		if formatted := FormatDecimal(r); formatted != expected {
+			t.Errorf("Formatted %s as '%s', expected '%s'", value, formatted, expected)
+		}
+	}
+}
+
+func TestType_Equal(t *testing.T) {
+	equal := map[Type][2]string{
+		String:  {"a", "a"},
+		Int:     {"10", "+10"},
+		Decimal: {"1.50", "1.5"},
+		Time:    {"2020-04-01T10:00:00Z", "2020-04-01T12:00:00+02:00"},
+	}
+	for typ, values := range equal {
+		if !typ.Equal(values[0], values[1]) {
+			t.Errorf("'%s' and '%s' differ as %s", values[0], values[1], typ)
+		}
+	}
+	if Decimal.Equal("1.5", "1.6") || String.Equal("1.5", "1.50") || Int.Equal("x", "y") {
+		t.Fatal("Different values are equal")
+	}
+}
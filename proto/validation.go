@@ -1,21 +1,187 @@
 package proto
 
 import (
-	"errors"
 	"fmt"
+	"sort"
 )
 
-// Validate a Protocol
+// Validate a Protocol in lenient mode: actions may use parameters that
+// aren't declared by the protocol. It returns a ValidationError with every
+// issue found. The issues it accepts are reported by Warnings.
 func Validate(p Protocol) error {
+	return validate(p, false)
+}
+
+// Warnings returns the issues of CheckInterface with Warning severity,
+// which lenient validation accepts
+func Warnings(p Protocol) []Issue {
+	issues := CheckInterface(p)
+	for i := range issues {
+		issues[i].Severity = Warning
+	}
+	return issues
+}
+
+// ValidateStrict validates a Protocol like Validate and also checks that
+// the actions are consistent with the parameters of the protocol, see
+// CheckInterface.
+func ValidateStrict(p Protocol) error {
+	return validate(p, true)
+}
+
+func validate(p Protocol, strict bool) error {
+	issues := make([]Issue, 0)
+	issues = append(issues, checkKeys(p)...)
+	issues = append(issues, checkTypes(p)...)
+	issues = append(issues, checkRoles(p)...)
+	issues = append(issues, checkDependencies(p)...)
+	if strict {
+		issues = append(issues, CheckInterface(p)...)
+	}
+	return newValidationError(issues)
+}
+
+// newValidationError returns a ValidationError with the issues as errors,
+// or nil if there are none
+func newValidationError(issues []Issue) error {
+	if len(issues) == 0 {
+		return nil
+	}
+	for i := range issues {
+		issues[i].Severity = Error
+	}
+	return ValidationError{Issues: issues}
+}
+
+// CheckInterface returns the issues found checking that every action
+// parameter is declared by the protocol with a consistent adornment, and
+// that every 'out' parameter of the protocol is outputted by an action.
+// Lenient users may report them as warnings.
+func CheckInterface(p Protocol) []Issue {
+	issues := make([]Issue, 0)
+	for _, a := range p.steps() {
+		for _, param := range a.Params {
+			declared, found := p.Param(param.Name)
+			if !found {
+				issues = append(issues, Issue{Code: UndeclaredParam, Check: InterfaceCheck,
+					Actions: []string{a.Name}, Params: []string{param.Name},
+					Message: fmt.Sprintf("Parameter '%s' of action '%s' is not declared in '%s'",
+						param.Name, a.Name, p.Name)})
+				continue
+			}
+			// actions can't bind the inputs of the protocol nor what must
+			// stay unbound, and can't wait for the latter
+			if param.Io == Out && declared.Io != Out || param.Io == In && declared.Io == Nil {
+				issues = append(issues, Issue{Code: AdornmentMismatch, Check: InterfaceCheck,
+					Actions: []string{a.Name}, Params: []string{param.Name},
+					Message: fmt.Sprintf("Parameter '%s' is '%s' in action '%s' but '%s' in '%s'",
+						param.Name, param.Io, a.Name, declared.Io, p.Name)})
+			}
+		}
+	}
+	for _, param := range p.Outs() {
+		if len(p.Producers(param.Name)) == 0 && !p.referenceOutputs(param.Name) {
+			issues = append(issues, Issue{Code: UnproducedParam, Check: InterfaceCheck,
+				Params:  []string{param.Name},
+				Message: fmt.Sprintf("No action outputs parameter '%s'", param.Name)})
+		}
+	}
+	return issues
+}
+
+// checkKeys checks that the protocol has key parameters, that each action
+// has at least one of them and that actions extending the key have all of
+// them
+func checkKeys(p Protocol) []Issue {
+	issues := make([]Issue, 0)
 	keyParams := p.Keys()
 	if len(keyParams) < 1 {
-		return errors.New("No key parameters")
+		return append(issues, Issue{Code: NoKeyParams, Check: KeyCheck,
+			Message: "No key parameters"})
+	}
+	for _, a := range p.steps() {
+		found := false
+		// check it at least one action parameter is a key protocol parameter
+	KeyCheck:
+		for _, k := range a.Params {
+			for _, pk := range keyParams {
+				if pk.Name == k.Name {
+					found = true
+					break KeyCheck
+				}
+			}
+		}
+		if !found {
+			issues = append(issues, Issue{Code: NoSharedKey, Check: KeyCheck,
+				Actions: []string{a.Name},
+				Message: fmt.Sprintf("Action '%s' has no key parameters in common with '%s'",
+					a.Name, p.Name)})
+			continue
+		}
+		// extended keys identify tuples of a single enactment
+		if len(p.ExtendedKey(a)) == 0 {
+			continue
+		}
+		for _, pk := range keyParams {
+			if !hasParam(a, pk.Name) {
+				issues = append(issues, Issue{Code: IncompleteKey, Check: KeyCheck,
+					Actions: []string{a.Name}, Params: []string{pk.Name},
+					Message: fmt.Sprintf("Action '%s' extends the key of '%s' without '%s'",
+						a.Name, p.Name, pk.Name)})
+			}
+		}
+	}
+	return issues
+}
+
+func hasParam(a Action, name string) bool {
+	for _, param := range a.Params {
+		if param.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTypes checks that parameter types are known and that typed action
+// parameters agree with the protocol
+func checkTypes(p Protocol) []Issue {
+	issues := make([]Issue, 0)
+	for _, param := range p.Params {
+		if !param.Type.Valid() {
+			issues = append(issues, unknownType(param, nil))
+		}
+	}
+	for _, a := range p.steps() {
+		for _, param := range a.Params {
+			if !param.Type.Valid() {
+				issues = append(issues, unknownType(param, []string{a.Name}))
+				continue
+			}
+			declared, found := p.Param(param.Name)
+			if param.Type != Untyped && found && declared.Type != Untyped &&
+				param.Type != declared.Type {
+				issues = append(issues, Issue{Code: TypeMismatch, Check: TypeCheck,
+					Actions: []string{a.Name}, Params: []string{param.Name},
+					Message: fmt.Sprintf("Parameter '%s' of action '%s' is %s but was declared %s",
+						param.Name, a.Name, param.Type, declared.Type)})
+			}
+		}
 	}
+	return issues
+}
 
-	// check that actions have at least one key and that key
-	// has been declared in the protocol parameters
+func unknownType(param Parameter, actions []string) Issue {
+	return Issue{Code: UnknownType, Check: TypeCheck, Actions: actions,
+		Params:  []string{param.Name},
+		Message: fmt.Sprintf("Unknown type of parameter '%s': %s", param.Name, param.Type)}
+}
+
+// checkRoles checks that both roles of each action are defined in the
+// protocol
+func checkRoles(p Protocol) []Issue {
+	issues := make([]Issue, 0)
 	for _, a := range p.Actions {
-		// check that both roles are defined in the protocol
 		for _, actionRole := range []Role{a.From, a.To} {
 			definedRole := false
 			for _, role := range p.Roles {
@@ -24,32 +190,190 @@ func Validate(p Protocol) error {
 				}
 			}
 			if !definedRole {
-				return ValidationError{Err: fmt.Errorf("Unknown role: %s", actionRole)}
+				issues = append(issues, unknownRole(a.Name, actionRole))
 			}
 		}
-		found := false
-		// check it at least one action parameter is a key protocol parameter
-	KeyCheck:
-		for _, k := range a.Params {
-			for _, pk := range keyParams {
-				if pk.Name == k.Name {
-					found = true
-					break KeyCheck
+	}
+	for _, r := range p.References {
+		for _, refRole := range r.Roles {
+			if !p.hasRole(refRole) {
+				issues = append(issues, unknownRole(r.Name, refRole))
+			}
+		}
+	}
+	return issues
+}
+
+func unknownRole(action string, r Role) Issue {
+	return Issue{Code: UnknownRole, Check: RoleCheck,
+		Actions: []string{action}, Roles: []Role{r},
+		Message: fmt.Sprintf("Unknown role: %s", r)}
+}
+
+func (p Protocol) hasRole(r Role) bool {
+	for _, role := range p.Roles {
+		if role == r {
+			return true
+		}
+	}
+	return false
+}
+
+// steps returns the actions of the protocol followed by its references
+// as actions without roles
+func (p Protocol) steps() []Action {
+	steps := append([]Action(nil), p.Actions...)
+	for _, r := range p.References {
+		steps = append(steps, r.action())
+	}
+	return steps
+}
+
+// checkDependencies reports each group of actions that depend on each
+// other
+func checkDependencies(p Protocol) []Issue {
+	issues := make([]Issue, 0)
+	for _, cycle := range cycles(p.steps()) {
+		names := make([]string, len(cycle))
+		for i, a := range cycle {
+			names[i] = a.Name
+		}
+		issues = append(issues, Issue{Code: Cycle, Check: DependencyCheck, Actions: names,
+			Message: fmt.Sprintf("Circular dependency at action '%s'", names[0])})
+	}
+	return issues
+}
+
+// cycles returns the strongly connected components of the dependency
+// graph with more than one action, in protocol order
+func cycles(as []Action) [][]Action {
+	n := len(as)
+	edges := make([][]int, n)
+	for i, a := range as {
+		for j, b := range as {
+			if i != j && len(intersection(a.Ins(), b.Outs())) > 0 {
+				edges[i] = append(edges[i], j)
+			}
+		}
+	}
+	// Tarjan's algorithm
+	index := make([]int, n)
+	low := make([]int, n)
+	onStack := make([]bool, n)
+	for i := range index {
+		index[i] = -1
+	}
+	stack := make([]int, 0)
+	components := make([][]int, 0)
+	next := 0
+	var connect func(v int)
+	connect = func(v int) {
+		index[v], low[v] = next, next
+		next++
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range edges[v] {
+			if index[w] < 0 {
+				connect(w)
+				if low[w] < low[v] {
+					low[v] = low[w]
 				}
+			} else if onStack[w] && index[w] < low[v] {
+				low[v] = index[w]
+			}
+		}
+		if low[v] == index[v] {
+			component := make([]int, 0)
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				component = append(component, w)
+				if w == v {
+					break
+				}
+			}
+			if len(component) > 1 {
+				sort.Ints(component)
+				components = append(components, component)
+			}
+		}
+	}
+	for v := 0; v < n; v++ {
+		if index[v] < 0 {
+			connect(v)
+		}
+	}
+	sort.Slice(components, func(i, j int) bool {
+		return components[i][0] < components[j][0]
+	})
+	result := make([][]Action, len(components))
+	for i, component := range components {
+		for _, v := range component {
+			result[i] = append(result[i], as[v])
+		}
+	}
+	return result
+}
+
+func (p Protocol) referenceOutputs(param string) bool {
+	for _, r := range p.References {
+		for _, x := range r.Outs() {
+			if x.Name == param {
+				return true
 			}
 		}
+	}
+	return false
+}
+
+// ValidateComposite validates a composite Protocol like Validate and
+// checks each reference against the protocol it references, found with
+// lookup: every role of the referenced protocol must be played and every
+// parameter passed with the same adornment and key.
+func ValidateComposite(p Protocol, lookup func(name string) (Protocol, bool)) error {
+	issues := make([]Issue, 0)
+	if err := Validate(p); err != nil {
+		issues = append(issues, err.(ValidationError).Issues...)
+	}
+	for _, r := range p.References {
+		child, found := lookup(r.Name)
 		if !found {
-			return ValidationError{Err: fmt.Errorf(
-				"Action '%s' has no key parameters in common with '%s'",
-				a.Name, p.Name)}
+			issues = append(issues, Issue{Code: UnknownProtocol, Check: CompositionCheck,
+				Actions: []string{r.Name},
+				Message: fmt.Sprintf("Unknown protocol: %s", r.Name)})
+			continue
 		}
+		issues = append(issues, checkReference(r, child)...)
 	}
-	dependencies := createLinkedActions(p.Actions)
-	if circ, a := areCircular(dependencies); circ {
-		return ValidationError{Err: fmt.Errorf(
-			"Circular dependency at action '%s'", a.Name)}
+	return newValidationError(issues)
+}
+
+func checkReference(r Reference, child Protocol) []Issue {
+	issues := make([]Issue, 0)
+	if len(r.Roles) != len(child.Roles) {
+		issues = append(issues, Issue{Code: ReferenceMismatch, Check: CompositionCheck,
+			Actions: []string{r.Name}, Roles: r.Roles,
+			Message: fmt.Sprintf("Reference to '%s' assigns %d roles, expected %d",
+				r.Name, len(r.Roles), len(child.Roles))})
 	}
-	return nil
+	refParams := paramMap(r.Params)
+	for _, param := range child.Params {
+		passed, found := refParams[param.Name]
+		if !found || passed.Io != param.Io || passed.Key != param.Key {
+			issues = append(issues, Issue{Code: ReferenceMismatch, Check: CompositionCheck,
+				Actions: []string{r.Name}, Params: []string{param.Name},
+				Message: fmt.Sprintf("Reference to '%s' must pass parameter '%s'",
+					r.Name, param)})
+		}
+		delete(refParams, param.Name)
+	}
+	for _, name := range sortedNames(refParams) {
+		issues = append(issues, Issue{Code: ReferenceMismatch, Check: CompositionCheck,
+			Actions: []string{r.Name}, Params: []string{name},
+			Message: fmt.Sprintf("Protocol '%s' has no parameter '%s'", r.Name, name)})
+	}
+	return issues
 }
 
 type linkedAction struct {
@@ -113,55 +437,3 @@ func createLinkedActions(as []Action) []*linkedAction {
 	}
 	return dependencies
 }
-
-func isChecked(l *linkedAction, checked []*linkedAction) bool {
-	for _, x := range checked {
-		if x == l {
-			return true
-		}
-	}
-	return false
-}
-
-func areCircular(la []*linkedAction) (bool, Action) {
-	// for each node, follow each link until the end or
-	// returning to self
-	// checking each node more than once is not effective but
-	// sad things happen and we must move on
-	checked := make([]*linkedAction, 0)
-	for _, d := range la {
-		// d was already checked when calling a previous isCircular()
-		if isChecked(d, checked) {
-			continue
-		}
-		if isCircular(d) {
-			return true, d.action
-		}
-	}
-	return false, Action{}
-}
-
-func isCircular(l *linkedAction) bool {
-	return _isCircular(l, []*linkedAction{})
-}
-
-func _isCircular(l *linkedAction, checked []*linkedAction) bool {
-	if l == nil {
-		panic("Invalid nil linkedAction")
-	}
-	if isChecked(l, checked) {
-		return true
-	}
-	checked = append(checked, l)
-	if len(l.dependsOn) == 0 {
-		return false
-	}
-
-	// for each next node, repeat
-	for _, dependsOn := range l.dependsOn {
-		if _isCircular(dependsOn, checked) {
-			return true
-		}
-	}
-	return false
-}
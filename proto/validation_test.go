@@ -1,56 +1,62 @@
 package proto
 
 import (
+	"errors"
 	"testing"
 )
 
-func TestIsCircular(t *testing.T) {
-	// a -> b -> c
-	aa := Action{Name: "aa"}
-	ab := Action{Name: "ab"}
-	ac := Action{Name: "ac"}
-	ad := Action{Name: "ad"}
-
-	c := &linkedAction{action: ac}
-	b := &linkedAction{action: ab, dependsOn: []*linkedAction{c}}
-	a := &linkedAction{action: aa, dependsOn: []*linkedAction{b}}
-
-	if isCircular(a) {
-		t.FailNow()
+// dependent returns an action with the given 'in' and 'out' parameters
+func dependent(name string, ins []string, outs ...string) Action {
+	a := Action{Name: name}
+	for _, in := range ins {
+		a.Params = append(a.Params, Parameter{Name: in, Io: In})
 	}
+	for _, out := range outs {
+		a.Params = append(a.Params, Parameter{Name: out, Io: Out})
+	}
+	return a
+}
 
+func TestCycles(t *testing.T) {
+	// a -> b -> c
+	aa := dependent("aa", []string{"b"})
+	ab := dependent("ab", []string{"c"}, "b")
+	ac := dependent("ac", nil, "c")
+	if cs := cycles([]Action{aa, ab, ac}); len(cs) != 0 {
+		t.Fatal(cs)
+	}
 	// a -> b -> c -> a
-	c.dependsOn = []*linkedAction{a}
-	if !isCircular(a) {
-		t.Fatal()
+	ac = dependent("ac", []string{"a"}, "c")
+	aa = dependent("aa", []string{"b"}, "a")
+	if cs := cycles([]Action{aa, ab, ac}); len(cs) != 1 || len(cs[0]) != 3 {
+		t.Fatal(cs)
 	}
-	// a -> b-> c
+	// a -> b -> c
 	// \-> d -/
-	c.dependsOn = nil
-	d := &linkedAction{action: ad, dependsOn: []*linkedAction{c}}
-	a.dependsOn = append(a.dependsOn, d)
-	if isCircular(a) {
-		t.Fatal()
+	aa = dependent("aa", []string{"b", "d"})
+	ac = dependent("ac", nil, "c")
+	ad := dependent("ad", []string{"c"}, "d")
+	if cs := cycles([]Action{aa, ab, ac, ad}); len(cs) != 0 {
+		t.Fatal(cs)
 	}
-	// a -> b-> c -> a
+	// a -> b -> c -> a
 	// \-> d -/
-	c.dependsOn = []*linkedAction{a}
-	if !isCircular(a) {
-		t.Fatal()
+	aa = dependent("aa", []string{"b", "d"}, "a")
+	ac = dependent("ac", []string{"a"}, "c")
+	if cs := cycles([]Action{aa, ab, ac, ad}); len(cs) != 1 || len(cs[0]) != 4 {
+		t.Fatal(cs)
 	}
 }
 
-func TestCreateLinkedActions(t *testing.T) {
+func TestCycles_Protocol(t *testing.T) {
 	p := testProtocol()
-	noncircular := createLinkedActions(p.Actions)
-	if circ, _ := areCircular(noncircular); circ {
-		t.FailNow()
+	if cs := cycles(p.Actions); len(cs) != 0 {
+		t.Fatal(cs)
 	}
 	// insert circular dependency
 	p.Actions[0].Params = append(p.Actions[0].Params, Parameter{Name: "price", Io: In})
-	circular := createLinkedActions(p.Actions)
-	if circ, _ := areCircular(circular); !circ {
-		t.FailNow()
+	if cs := cycles(p.Actions); len(cs) != 1 {
+		t.Fatal(cs)
 	}
 }
 
@@ -62,6 +68,24 @@ func TestValidate(t *testing.T) {
 		t.Log(err)
 		t.FailNow()
 	}
+	// conflicting types
+	p.Params[2].Type = Decimal
+	p.Actions[1].Params[2].Type = Int
+	if err := Validate(p); err == nil {
+		t.Log(errMsg)
+		t.FailNow()
+	}
+	p.Actions[1].Params[2].Type = Decimal
+	if err := Validate(p); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	p.Params[2].Type = "money"
+	if err := Validate(p); err == nil {
+		t.Log(errMsg)
+		t.FailNow()
+	}
+	p.Params[2].Type = Decimal
 	// insert circular dependency
 	p.Actions[0].Params = append(p.Actions[0].Params, Parameter{Name: "price", Io: In})
 	if err := Validate(p); err == nil {
@@ -89,3 +113,83 @@ func TestValidate(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestValidate_Issues(t *testing.T) {
+	p := testProtocol()
+	p.Params[2].Type = "money"
+	p.Actions[0].To = "Shipper"
+	// Request and Offer depend on each other
+	p.Actions[0].Params = append(p.Actions[0].Params, Parameter{Name: "price", Io: In})
+	p.Actions = append(p.Actions, Action{Name: "Nokeyparams", From: p.Roles[0], To: p.Roles[1],
+		Params: []Parameter{{Name: "madeup"}}})
+	err := Validate(p)
+	var ve ValidationError
+	if !errors.As(err, &ve) || len(ve.Issues) != 4 {
+		t.Fatal(err)
+	}
+	for _, code := range []IssueCode{UnknownType, UnknownRole, NoSharedKey, Cycle} {
+		if !errors.Is(err, code) {
+			t.Fatalf("Missing %s in %s", code, err)
+		}
+	}
+	if errors.Is(err, TypeMismatch) {
+		t.Fatal(err)
+	}
+	cycle := ve.Find(Cycle)
+	if len(cycle) != 1 || cycle[0].Check != DependencyCheck || len(cycle[0].Actions) != 2 {
+		t.Fatal(cycle)
+	}
+	role := ve.Find(UnknownRole)[0]
+	if role.Roles[0] != "Shipper" || role.Actions[0] != "Request" {
+		t.Fatal(role)
+	}
+	var issue Issue
+	if !errors.As(err, &issue) || issue.Code != NoSharedKey || issue.Actions[0] != "Nokeyparams" {
+		t.Fatal(issue)
+	}
+	// issues of protocols built with Builder are found too
+	_, err = NewBuilder("P").Roles("A").Param(OutParam("ID")).Build()
+	if !errors.Is(err, NoKeyParams) || !errors.As(err, &ve) {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateStrict(t *testing.T) {
+	p := testProtocol()
+	if err := ValidateStrict(p); err != nil {
+		t.Fatal(err)
+	}
+	p.Params = append(p.Params, Parameter{Name: "buyer", Io: In}, Parameter{Name: "done", Io: Out})
+	p.Actions[0].Params = append(p.Actions[0].Params, Parameter{Name: "buyer", Io: Out},
+		Parameter{Name: "address", Io: Out})
+	// lenient validation reports the interface issues as warnings
+	if err := Validate(p); err != nil {
+		t.Fatal(err)
+	}
+	warnings := Warnings(p)
+	if len(warnings) != 3 {
+		t.Fatalf("Unexpected warnings: %v", warnings)
+	}
+	for _, w := range warnings {
+		if w.Severity != Warning {
+			t.Fatalf("Unexpected severity: %v", w)
+		}
+	}
+	err := ValidateStrict(p)
+	var ve ValidationError
+	if !errors.As(err, &ve) || len(ve.Issues) != 3 || ve.Issues[0].Severity != Error {
+		t.Fatal(err)
+	}
+	if issues := ve.Find(AdornmentMismatch); len(issues) != 1 || issues[0].Params[0] != "buyer" {
+		t.Fatal(err)
+	}
+	if issues := ve.Find(UndeclaredParam); len(issues) != 1 || issues[0].Params[0] != "address" {
+		t.Fatal(err)
+	}
+	if issues := ve.Find(UnproducedParam); len(issues) != 1 || issues[0].Params[0] != "done" {
+		t.Fatal(err)
+	}
+	if len(CheckInterface(p)) != 3 {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,19 @@
+package reason
+
+import "time"
+
+// Clock abstracts the passing of time so instance deadlines can be
+// tested deterministically
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// AfterFunc calls f after the duration d has elapsed.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a call scheduled by a Clock
+type Timer interface {
+	// Stop prevents the Timer from firing. It returns false if the
+	// call has already been made or the timer was already stopped.
+	Stop() bool
+}
@@ -0,0 +1,51 @@
+package reason
+
+import (
+	"fmt"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+// Complete returns true if every 'out' parameter of the protocol of an
+// instance is bound, in the instance or in a tuple, see TupleStore
+func Complete(i Instance) bool {
+	ts, _ := i.(TupleStore)
+	for _, out := range i.Protocol().Outs() {
+		if i.GetValue(out.Name) == "" && (ts == nil || !ts.TupleBound(out.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ChildBindings returns the roles and inputs of an instance of the child
+// protocol of a reference, taken from the parent instance. Every 'in'
+// parameter of the reference must be bound in the parent and none of its
+// 'out' parameters.
+func ChildBindings(parent Instance, ref proto.Reference, child proto.Protocol) (Roles, Values, error) {
+	if ref.Name != child.Name {
+		return nil, nil, fmt.Errorf("Reference to '%s' used for '%s'", ref.Name, child.Name)
+	}
+	roles := make(Roles, len(child.Roles))
+	for childRole, parentRole := range ref.RoleMap(child) {
+		agent, found := parent.Roles()[parentRole]
+		if !found {
+			return nil, nil, fmt.Errorf("Unassigned role: %s", parentRole)
+		}
+		roles[childRole] = agent
+	}
+	ins := make(Values)
+	for _, in := range ref.Ins() {
+		v := parent.GetValue(in.Name)
+		if v == "" {
+			return nil, nil, fmt.Errorf("Input '%s' of '%s' is not bound", in.Name, ref.Name)
+		}
+		ins[in.Name] = v
+	}
+	for _, out := range ref.Outs() {
+		if parent.GetValue(out.Name) != "" {
+			return nil, nil, fmt.Errorf("Output '%s' of '%s' is already bound", out.Name, ref.Name)
+		}
+	}
+	return roles, ins, nil
+}
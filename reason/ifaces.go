@@ -4,6 +4,11 @@ import "github.com/mikelsr/bspl/proto"
 
 // Instance of a Protocol
 type Instance interface {
+	// AddChild links an instance of a protocol referenced by the
+	// protocol of this instance.
+	AddChild(key string)
+	// Children returns the keys of the child instances.
+	Children() []string
 	// Diff identifies what action has been run between two versions of an
 	// instance. It returns the action, the new values and an error.
 	// Currently only one action is supported between instace versions.
@@ -11,7 +16,8 @@ type Instance interface {
 	// e.g. Accept or Reject. In that case the Reasoner must find out which
 	// one it was.
 	Diff(Instance) ([]proto.Action, Values, error)
-	// Equals compares two instances.
+	// Equals compares two instances: same protocol content hash, role
+	// bindings and values.
 	Equals(Instance) bool
 	// GetValue returns the value of the parameter of an instance.
 	GetValue(string) string
@@ -21,12 +27,16 @@ type Instance interface {
 	Marshal() ([]byte, error)
 	// Parameters of the Instance.
 	Parameters() Values
+	// Parent returns the key of the instance that created this one as a
+	// step of a composite protocol, if any.
+	Parent() string
 	// Protocol of the Instance.
 	Protocol() proto.Protocol
 	// Roles of the Instance.
 	Roles() Roles
-	// SetValue of an instance parameter.s
-	SetValue(string, string)
+	// SetValue of an instance parameter. The value must belong to the
+	// type of the parameter.
+	SetValue(string, string) error
 	// Unmarshal an Instance from bytes
 	Unmarshal([]byte) error
 	// Update updates an instance given the same instance
@@ -38,15 +48,41 @@ type Instance interface {
 
 // Reasoner handles the protocol instances and actions related to them
 type Reasoner interface {
+	// BindTuple binds values in the tuple of an instance identified by the
+	// values of an extended key, see TupleStore. Like UpdateInstance, it
+	// restarts the idle timeout of the instance.
+	BindTuple(instanceKey string, key Values, values Values) error
 	// DropInstance cancels an Instance for whatever motive
 	DropInstance(instanceKey string, motive string) error
 	// GetInstance returns an Instance given the instance key
 	GetInstance(instanceKey string) (Instance, bool)
+	// Snapshot returns a copy of an instance that can be read while the
+	// instance is updated
+	Snapshot(instanceKey string) (Instance, bool)
 	// All instances of a Protocol
 	Instances(p proto.Protocol) []Instance
+	// Query returns the instances of a Protocol that meet every condition
+	Query(p proto.Protocol, conditions ...Condition) []Instance
 	// Instantiate a protocol. Check if the assigned role is a role
-	// the reasoner is willing to play.
-	Instantiate(p proto.Protocol, roles Roles, ins Values) (Instance, error)
+	// the reasoner is willing to play. The ins must bind exactly the 'in'
+	// parameters of the protocol and keys its other key parameters, see
+	// CheckInputs. The options may set a deadline or an idle timeout after
+	// which the instance is dropped with MotiveTimeout.
+	Instantiate(p proto.Protocol, roles Roles, keys Values, ins Values, opts ...InstanceOption) (Instance, error)
+	// Spawn creates an instance of a protocol referenced by the protocol
+	// of a parent instance. Its roles and inputs are taken from the parent,
+	// see ChildBindings, and its outputs are bound in the parent when it
+	// completes.
+	Spawn(parentKey string, child proto.Protocol, opts ...InstanceOption) (Instance, error)
+	// Pending returns the messages parked for an instance, in the order
+	// they were received.
+	Pending(instanceKey string) []Message
+	// Receive applies a message received by an agent to an instance.
+	// Messages carrying 'in' parameters the instance doesn't know yet are
+	// parked and retried once a later message binds them. It returns the
+	// messages applied, in order: the received one followed by the parked
+	// ones it enabled, or none if it was parked.
+	Receive(instanceKey string, m Message) ([]Message, error)
 	// RegisterInstance registers an Instance created by another Reasoner
 	RegisterInstance(i Instance) error
 	// UpdateInstance updates an instance with a newer version of itself
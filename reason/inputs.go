@@ -0,0 +1,61 @@
+package reason
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+// InputError is returned when a protocol is instantiated without
+// binding exactly its 'in' parameters, or with keys that aren't key
+// parameters
+type InputError struct {
+	Protocol string
+	// Missing 'in' parameters
+	Missing []string
+	// Extra inputs that aren't 'in' parameters and keys that aren't key
+	// parameters or are 'in' parameters
+	Extra []string
+}
+
+func (e InputError) Error() string {
+	msgs := make([]string, 0, 2)
+	if len(e.Missing) > 0 {
+		msgs = append(msgs, "missing "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Extra) > 0 {
+		msgs = append(msgs, "unexpected "+strings.Join(e.Extra, ", "))
+	}
+	return fmt.Sprintf("Invalid inputs of '%s': %s", e.Protocol, strings.Join(msgs, "; "))
+}
+
+// CheckInputs checks the bindings of a new instance: ins must bind exactly
+// the 'in' parameters of the protocol, and keys may bind its other key
+// parameters to identify the instance before the action that outputs
+// them runs.
+func CheckInputs(p proto.Protocol, keys Values, ins Values) error {
+	e := InputError{Protocol: p.Name}
+	for _, in := range p.Ins() {
+		if ins[in.Name] == "" {
+			e.Missing = append(e.Missing, in.Name)
+		}
+	}
+	for name := range ins {
+		if param, found := p.Param(name); !found || param.Io != proto.In {
+			e.Extra = append(e.Extra, name)
+		}
+	}
+	for name := range keys {
+		if param, found := p.Param(name); !found || !param.Key || param.Io == proto.In {
+			e.Extra = append(e.Extra, name)
+		}
+	}
+	if len(e.Missing) == 0 && len(e.Extra) == 0 {
+		return nil
+	}
+	sort.Strings(e.Missing)
+	sort.Strings(e.Extra)
+	return e
+}
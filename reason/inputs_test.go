@@ -0,0 +1,40 @@
+package reason
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+func TestCheckInputs(t *testing.T) {
+	p := proto.Protocol{Name: "Ship", Params: append(testParams(),
+		proto.Parameter{Name: "address", Io: proto.In},
+		proto.Parameter{Name: "weight", Io: proto.In})}
+	if err := CheckInputs(p, nil, Values{"address": "A", "weight": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	// key parameters identify the instance
+	if err := CheckInputs(p, Values{"ID": "1"}, Values{"address": "A", "weight": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	// but are not inputs
+	if err := CheckInputs(p, nil, Values{"ID": "1", "address": "A", "weight": "1"}); err == nil {
+		t.Fatal("Accepted an 'out' key as input")
+	}
+	if err := CheckInputs(p, Values{"ID": "1", "address": "A"}, Values{"weight": "1"}); err == nil {
+		t.Fatal("Accepted an input as key")
+	}
+	err := CheckInputs(p, nil, Values{"address": "A", "price": "2", "madeup": "3"})
+	var ie InputError
+	if !errors.As(err, &ie) {
+		t.Fatal(err)
+	}
+	if len(ie.Missing) != 1 || ie.Missing[0] != "weight" ||
+		len(ie.Extra) != 2 || ie.Extra[0] != "madeup" || ie.Extra[1] != "price" {
+		t.Fatal(ie)
+	}
+	if err.Error() != "Invalid inputs of 'Ship': missing weight; unexpected madeup, price" {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,70 @@
+package reason
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+// Message carries the bindings of an action from the role sending it
+// to the role receiving it
+type Message struct {
+	// Protocol is the key of the protocol being enacted
+	Protocol string `json:"protocol"`
+	// Action sent
+	Action proto.Action `json:"action"`
+	// Roles of the instance the action belongs to
+	Roles Roles `json:"roles"`
+	// Values of the parameters of the action by parameter name
+	Values Values `json:"values"`
+}
+
+// ID of the message: the hex SHA-256 of its protocol, action, roles and
+// values. Redeliveries of a message have the same ID.
+func (m Message) ID() string {
+	var sb strings.Builder
+	sb.WriteString(m.Protocol + "\n" + m.Action.String() + "\n")
+	roles := make([]string, 0, len(m.Roles))
+	for r, agent := range m.Roles {
+		roles = append(roles, fmt.Sprintf("%q=%q", r, agent))
+	}
+	sort.Strings(roles)
+	sb.WriteString(strings.Join(roles, ",") + "\n")
+	names := make([]string, 0, len(m.Values))
+	for name := range m.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("%q=%q,", name, m.Values[name]))
+	}
+	sum := sha256.Sum256([]byte(sb.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// IntegrityViolation is returned when a message or a newer version of an
+// instance binds a parameter the instance already knows to a different
+// value, e.g. a duplicate Offer with a different price
+type IntegrityViolation struct {
+	// Instance key
+	Instance string `json:"instance"`
+	// Action that carried the new value, if known
+	Action string `json:"action,omitempty"`
+	Param  string `json:"parameter"`
+	// Known value of the parameter and Received one
+	Known    string `json:"known"`
+	Received string `json:"received"`
+}
+
+func (e IntegrityViolation) Error() string {
+	var by string
+	if e.Action != "" {
+		by = fmt.Sprintf(" by '%s'", e.Action)
+	}
+	return fmt.Sprintf("Integrity violation in '%s': '%s' is '%s', received '%s'%s",
+		e.Instance, e.Param, e.Known, e.Received, by)
+}
@@ -0,0 +1,55 @@
+package reason
+
+import "time"
+
+const (
+	// MotiveTimeout is the motive used to drop an Instance whose
+	// deadline or idle timeout has expired
+	MotiveTimeout = "timeout"
+	// MotiveRejected is the motive used to drop an Instance created for a
+	// message that was not applied
+	MotiveRejected = "rejected"
+)
+
+// InstanceOptions configure the lifetime of an Instance
+type InstanceOptions struct {
+	// Deadline after which the Instance is dropped. The zero value
+	// means no deadline.
+	Deadline time.Time
+	// IdleTimeout drops the Instance if it is not updated for the
+	// given duration. The zero value means no timeout.
+	IdleTimeout time.Duration
+}
+
+// InstanceOption modifies the InstanceOptions of an Instance
+type InstanceOption func(*InstanceOptions)
+
+// WithDeadline drops the Instance at the given time
+func WithDeadline(deadline time.Time) InstanceOption {
+	return func(o *InstanceOptions) {
+		o.Deadline = deadline
+	}
+}
+
+// WithIdleTimeout drops the Instance if it is not updated for
+// the given duration
+func WithIdleTimeout(timeout time.Duration) InstanceOption {
+	return func(o *InstanceOptions) {
+		o.IdleTimeout = timeout
+	}
+}
+
+// NewInstanceOptions applies a list of InstanceOption to the
+// default InstanceOptions
+func NewInstanceOptions(opts ...InstanceOption) InstanceOptions {
+	var o InstanceOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Expires returns true if the options define a deadline or a timeout
+func (o InstanceOptions) Expires() bool {
+	return !o.Deadline.IsZero() || o.IdleTimeout > 0
+}
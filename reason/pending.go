@@ -0,0 +1,74 @@
+package reason
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultMaxPending is the number of messages parked per instance when
+// no limit is set
+const DefaultMaxPending = 16
+
+var (
+	// ErrPendingFull is returned when a message can't be parked because
+	// the pending queue of its instance is full
+	ErrPendingFull = errors.New("Pending queue full")
+	// ErrPendingExpired is passed to PendingOptions.OnDiscard when a
+	// parked message expires
+	ErrPendingExpired = errors.New("Pending message expired")
+)
+
+// PendingOptions configure the queue of messages a Reasoner parks until
+// the 'in' parameters they carry are known by their instance
+type PendingOptions struct {
+	// MaxMessages parked per instance. The zero value means
+	// DefaultMaxPending.
+	MaxMessages int
+	// Expiry after which a parked message is discarded. The zero value
+	// means parked messages never expire.
+	Expiry time.Duration
+	// OnDiscard is called with the instance key, the message and the
+	// motive when a parked message expires or fails once retried.
+	OnDiscard func(instanceKey string, m Message, err error)
+}
+
+// PendingOption modifies the PendingOptions of a Reasoner
+type PendingOption func(*PendingOptions)
+
+// WithMaxPending limits the messages parked per instance
+func WithMaxPending(n int) PendingOption {
+	return func(o *PendingOptions) {
+		o.MaxMessages = n
+	}
+}
+
+// WithPendingExpiry discards parked messages after the given duration
+func WithPendingExpiry(d time.Duration) PendingOption {
+	return func(o *PendingOptions) {
+		o.Expiry = d
+	}
+}
+
+// OnPendingDiscard sets the function called when a parked message is
+// discarded
+func OnPendingDiscard(f func(instanceKey string, m Message, err error)) PendingOption {
+	return func(o *PendingOptions) {
+		o.OnDiscard = f
+	}
+}
+
+// NewPendingOptions applies a list of PendingOption to the default
+// PendingOptions
+func NewPendingOptions(opts ...PendingOption) PendingOptions {
+	o := PendingOptions{MaxMessages: DefaultMaxPending}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.MaxMessages <= 0 {
+		o.MaxMessages = DefaultMaxPending
+	}
+	if o.OnDiscard == nil {
+		o.OnDiscard = func(string, Message, error) {}
+	}
+	return o
+}
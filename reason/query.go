@@ -0,0 +1,74 @@
+package reason
+
+import "github.com/mikelsr/bspl/proto"
+
+// ConditionKind identifies the check made by a Condition
+type ConditionKind int
+
+const (
+	// ParamEquals matches instances where a parameter is bound to a value
+	ParamEquals ConditionKind = iota
+	// ParamUnbound matches instances where a parameter is not bound
+	ParamUnbound
+	// ActionEnabled matches instances where a role can run an action
+	ActionEnabled
+)
+
+// Condition an Instance must meet to be returned by Reasoner.Query.
+// Conditions are plain values so reasoners can answer them from indexes.
+type Condition struct {
+	Kind ConditionKind
+	// Param is the name of the parameter of ParamEquals and ParamUnbound
+	Param string
+	// Value of the parameter for ParamEquals
+	Value string
+	// Role running the action for ActionEnabled
+	Role proto.Role
+	// Action name for ActionEnabled
+	Action string
+}
+
+// WhereEquals matches instances where the parameter is bound to value.
+func WhereEquals(param string, value string) Condition {
+	return Condition{Kind: ParamEquals, Param: param, Value: value}
+}
+
+// WhereUnbound matches instances where the parameter has no value.
+func WhereUnbound(param string) Condition {
+	return Condition{Kind: ParamUnbound, Param: param}
+}
+
+// WhereEnabled matches instances where role can send the action.
+func WhereEnabled(role proto.Role, action string) Condition {
+	return Condition{Kind: ActionEnabled, Role: role, Action: action}
+}
+
+// Match checks the condition against an instance without using indexes.
+func (c Condition) Match(i Instance) bool {
+	switch c.Kind {
+	case ParamEquals:
+		return c.Value != "" && i.GetValue(c.Param) == c.Value
+	case ParamUnbound:
+		return i.GetValue(c.Param) == ""
+	case ActionEnabled:
+		for _, a := range i.Protocol().Actions {
+			if a.Name == c.Action && a.From == c.Role && Enabled(i, a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Enabled returns true if an action can be run on an instance: every
+// 'in' parameter of the action is bound and every 'out' and 'nil'
+// parameter is not.
+func Enabled(i Instance, a proto.Action) bool {
+	for _, param := range a.Params {
+		bound := i.GetValue(param.Name) != ""
+		if bound != (param.Io == proto.In) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package reason
+
+import (
+	"fmt"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+// TupleStore is implemented by instances that keep the bindings of the
+// actions with an extended key, see proto.Protocol.ExtendedKey: one set of
+// bindings for each tuple of values of the extended key, e.g. for each
+// item of an order. The bindings of a tuple include its key.
+type TupleStore interface {
+	// Tuple returns the bindings of the tuple identified by the values of
+	// an extended key, and false if nothing is bound for it.
+	Tuple(key Values) (Values, bool)
+	// BindTuple binds values in the tuple identified by the values of an
+	// extended key. Values contradicting the tuple return an
+	// IntegrityViolation and nothing is bound.
+	BindTuple(key Values, values Values) error
+	// Tuples returns the tuples of the extended key with the given
+	// parameter names that meet every condition, see MatchTuple.
+	Tuples(key []string, conditions ...Condition) []Values
+	// TupleBound returns true if any tuple binds the parameter.
+	TupleBound(param string) bool
+}
+
+// TupleKey returns the values of the extended key of an action taken from
+// values, which must bind all of them
+func TupleKey(p proto.Protocol, a proto.Action, values Values) (Values, error) {
+	key := make(Values)
+	for _, k := range p.ExtendedKey(a) {
+		v := values[k.Name]
+		if v == "" {
+			return nil, fmt.Errorf("Missing value for key '%s' of action '%s'", k.Name, a.Name)
+		}
+		key[k.Name] = v
+	}
+	return key, nil
+}
+
+// TupleValue returns the binding of a parameter visible from a tuple of an
+// instance: the binding in the tuple if there is one and otherwise the
+// binding in the instance
+func TupleValue(i Instance, tuple Values, param string) string {
+	if v := tuple[param]; v != "" {
+		return v
+	}
+	return i.GetValue(param)
+}
+
+// EnabledIn returns true if an action can be run on the tuple of an
+// instance identified by the values of the extended key of the action,
+// like Enabled does for actions without an extended key. The parameters
+// of the extended key are bound if the tuple exists.
+func EnabledIn(i Instance, a proto.Action, key Values) bool {
+	extended := i.Protocol().ExtendedKey(a)
+	if len(extended) == 0 {
+		return Enabled(i, a)
+	}
+	ts, ok := i.(TupleStore)
+	if !ok {
+		return false
+	}
+	tuple, exists := ts.Tuple(key)
+	isKey := make(map[string]bool, len(extended))
+	for _, k := range extended {
+		isKey[k.Name] = true
+	}
+	for _, param := range a.Params {
+		var bound bool
+		if isKey[param.Name] {
+			bound = exists
+		} else {
+			bound = TupleValue(i, tuple, param.Name) != ""
+		}
+		if bound != (param.Io == proto.In) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchTuple checks the condition against a tuple of an instance. Values
+// are looked up with TupleValue and ActionEnabled conditions use the key
+// of the action taken from the tuple.
+func (c Condition) MatchTuple(i Instance, tuple Values) bool {
+	switch c.Kind {
+	case ParamEquals:
+		return c.Value != "" && TupleValue(i, tuple, c.Param) == c.Value
+	case ParamUnbound:
+		return TupleValue(i, tuple, c.Param) == ""
+	case ActionEnabled:
+		for _, a := range i.Protocol().Actions {
+			if a.Name != c.Action || a.From != c.Role {
+				continue
+			}
+			key, err := TupleKey(i.Protocol(), a, tuple)
+			if err == nil && EnabledIn(i, a, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
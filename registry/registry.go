@@ -0,0 +1,120 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+// Entry of a protocol in the Registry
+type Entry struct {
+	Protocol proto.Protocol
+	// Hash is the content hash of the protocol, see proto.Protocol.Hash
+	Hash string
+	// Version assigned to the protocol when it was registered
+	Version string
+}
+
+// ConflictError is returned when a name and version are already
+// registered for a different protocol
+type ConflictError struct {
+	Name     string
+	Version  string
+	Existing string
+	New      string
+}
+
+func (e ConflictError) Error() string {
+	return fmt.Sprintf("Protocol '%s' version '%s' is already registered with hash %s, got %s",
+		e.Name, e.Version, e.Existing, e.New)
+}
+
+// Registry stores protocols under their content hash and under their name
+// and version, so instances can refer to the exact protocol they were
+// created with
+type Registry struct {
+	mu     sync.RWMutex
+	byHash map[string]Entry
+	byName map[string]map[string]Entry
+}
+
+// New is the default constructor for Registry.
+func New() *Registry {
+	return &Registry{
+		byHash: make(map[string]Entry),
+		byName: make(map[string]map[string]Entry),
+	}
+}
+
+// Register a valid protocol under a version. Registering the same
+// protocol again is a no-op, registering a different protocol with the
+// same name and version returns a ConflictError.
+func (r *Registry) Register(p proto.Protocol, version string) (Entry, error) {
+	if version == "" {
+		return Entry{}, fmt.Errorf("Empty version of protocol '%s'", p.Name)
+	}
+	if err := proto.Validate(p); err != nil {
+		return Entry{}, err
+	}
+	e := Entry{Protocol: p.Clone(), Hash: p.Hash(), Version: version}
+	e.Protocol.Sort()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	versions, found := r.byName[p.Name]
+	if !found {
+		versions = make(map[string]Entry)
+		r.byName[p.Name] = versions
+	}
+	if existing, found := versions[version]; found {
+		if existing.Hash != e.Hash {
+			return Entry{}, ConflictError{Name: p.Name, Version: version,
+				Existing: existing.Hash, New: e.Hash}
+		}
+		return existing, nil
+	}
+	versions[version] = e
+	// the first version registered with a hash is kept for lookups by hash
+	if _, found := r.byHash[e.Hash]; !found {
+		r.byHash[e.Hash] = e
+	}
+	return e, nil
+}
+
+// Get the protocol registered with a name and version
+func (r *Registry) Get(name string, version string) (Entry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, found := r.byName[name][version]
+	return e, found
+}
+
+// ByHash returns the protocol with a content hash
+func (r *Registry) ByHash(hash string) (Entry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, found := r.byHash[hash]
+	return e, found
+}
+
+// Lookup a protocol by content hash
+func (r *Registry) Lookup(hash string) (proto.Protocol, bool) {
+	e, found := r.ByHash(hash)
+	return e.Protocol, found
+}
+
+// Versions returns the entries of a protocol name sorted by version
+func (r *Registry) Versions(name string) []Entry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entries := make([]Entry, 0, len(r.byName[name]))
+	for _, e := range r.byName[name] {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Version < entries[j].Version
+	})
+	return entries
+}
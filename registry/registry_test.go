@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+func testProtocol() proto.Protocol {
+	buyer := proto.Role("Buyer")
+	seller := proto.Role("Seller")
+	return proto.Protocol{
+		Name:  "Purchase",
+		Roles: []proto.Role{buyer, seller},
+		Params: []proto.Parameter{
+			{Name: "ID", Key: true, Io: proto.Out},
+			{Name: "item", Io: proto.Out},
+			{Name: "price", Io: proto.Out},
+		},
+		Actions: []proto.Action{
+			{Name: "Request", From: buyer, To: seller, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.Out},
+				{Name: "item", Io: proto.Out},
+			}},
+			{Name: "Offer", From: seller, To: buyer, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "item", Io: proto.In},
+				{Name: "price", Io: proto.Out},
+			}},
+		},
+	}
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r := New()
+	p := testProtocol()
+	e, err := r.Register(p, "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Hash != p.Hash() || e.Version != "1.0" {
+		t.Fatal(e)
+	}
+	// registering the same content is a no-op
+	q := testProtocol()
+	q.Actions[0], q.Actions[1] = q.Actions[1], q.Actions[0]
+	if again, err := r.Register(q, "1.0"); err != nil || again.Hash != e.Hash {
+		t.Fatal(err)
+	}
+	// a new version
+	q.Params[2].Type = proto.Decimal
+	for i := range q.Actions {
+		for j := range q.Actions[i].Params {
+			if q.Actions[i].Params[j].Name == "price" {
+				q.Actions[i].Params[j].Type = proto.Decimal
+			}
+		}
+	}
+	v2, err := r.Register(q, "2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// conflicting redefinition
+	_, err = r.Register(q, "1.0")
+	var conflict ConflictError
+	if !errors.As(err, &conflict) || conflict.Existing != e.Hash || conflict.New != v2.Hash {
+		t.Fatal(err)
+	}
+	if _, err := r.Register(p, ""); err == nil {
+		t.Fatal("Registered protocol without version")
+	}
+	invalid := testProtocol()
+	invalid.Actions[0].From = "Nobody"
+	if _, err := r.Register(invalid, "3.0"); err == nil {
+		t.Fatal("Registered invalid protocol")
+	}
+}
+
+func TestRegistry_Lookup(t *testing.T) {
+	r := New()
+	p := testProtocol()
+	e, _ := r.Register(p, "1.0")
+	if got, found := r.Get("Purchase", "1.0"); !found || got.Hash != e.Hash {
+		t.FailNow()
+	}
+	if _, found := r.Get("Purchase", "2.0"); found {
+		t.FailNow()
+	}
+	got, found := r.Lookup(p.Hash())
+	if !found || got.Hash() != p.Hash() {
+		t.FailNow()
+	}
+	if _, found := r.ByHash("unknown"); found {
+		t.FailNow()
+	}
+	r.Register(p, "1.1")
+	versions := r.Versions("Purchase")
+	if len(versions) != 2 || versions[0].Version != "1.0" || versions[1].Version != "1.1" {
+		t.Fatal(versions)
+	}
+	if len(r.Versions("Unknown")) != 0 {
+		t.FailNow()
+	}
+}
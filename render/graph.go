@@ -0,0 +1,73 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+// DOT writes the action dependency graph of a protocol in Graphviz DOT.
+// Edges go from an action to the actions that depend on it and are
+// labelled with the parameters that cause the dependency.
+func DOT(w io.Writer, p proto.Protocol) error {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("digraph %s {\n", quote(p.Name)))
+	for i, a := range p.Actions {
+		sb.WriteString(fmt.Sprintf("\t%s [label=%s];\n", nodeID(i),
+			quote(a.Name+"\n"+string(a.From)+" -> "+string(a.To))))
+	}
+	for _, d := range p.Graph() {
+		sb.WriteString(fmt.Sprintf("\t%s -> %s [label=%s];\n",
+			nodeID(actionIndex(p, d.DependsOn)), nodeID(actionIndex(p, d.Action)),
+			quote(paramNames(d.Params))))
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// MermaidFlowchart writes the action dependency graph of a protocol as
+// a Mermaid flowchart, see DOT.
+func MermaidFlowchart(w io.Writer, p proto.Protocol) error {
+	var sb strings.Builder
+	sb.WriteString("flowchart TD\n")
+	for i, a := range p.Actions {
+		sb.WriteString(fmt.Sprintf("\t%s[\"%s<br/>%s -> %s\"]\n", nodeID(i),
+			a.Name, a.From, a.To))
+	}
+	for _, d := range p.Graph() {
+		sb.WriteString(fmt.Sprintf("\t%s -->|%s| %s\n",
+			nodeID(actionIndex(p, d.DependsOn)), paramNames(d.Params),
+			nodeID(actionIndex(p, d.Action))))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// nodeID identifies actions by position as names may be repeated
+func nodeID(i int) string {
+	return fmt.Sprintf("a%d", i)
+}
+
+func actionIndex(p proto.Protocol, a proto.Action) int {
+	for i, x := range p.Actions {
+		if x.String() == a.String() {
+			return i
+		}
+	}
+	return -1
+}
+
+func paramNames(params []proto.Parameter) string {
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = param.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func quote(s string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(s) + "\""
+}
@@ -0,0 +1,112 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+func testProtocol() proto.Protocol {
+	buyer := proto.Role("Buyer")
+	seller := proto.Role("Seller")
+	p := proto.Protocol{
+		Name:  "Purchase",
+		Roles: []proto.Role{buyer, seller},
+		Params: []proto.Parameter{
+			{Name: "ID", Key: true, Io: proto.Out},
+			{Name: "item", Io: proto.Out},
+			{Name: "price", Io: proto.Out},
+			{Name: "decision", Io: proto.Out},
+		},
+		Actions: []proto.Action{
+			{Name: "Request", From: buyer, To: seller, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.Out},
+				{Name: "item", Io: proto.Out},
+			}},
+			{Name: "Offer", From: seller, To: buyer, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "item", Io: proto.In},
+				{Name: "price", Io: proto.Out},
+			}},
+			{Name: "Accept", From: buyer, To: seller, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "price", Io: proto.In},
+				{Name: "decision", Io: proto.Out},
+			}},
+			{Name: "Reject", From: buyer, To: seller, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "price", Io: proto.In},
+				{Name: "decision", Io: proto.Out},
+			}},
+		},
+	}
+	p.Sort()
+	return p
+}
+
+func TestDOT(t *testing.T) {
+	var sb strings.Builder
+	if err := DOT(&sb, testProtocol()); err != nil {
+		t.Fatal(err)
+	}
+	out := sb.String()
+	// actions are sorted: Accept, Reject, Request, Offer
+	for _, expected := range []string{
+		"digraph \"Purchase\" {",
+		"a2 [label=\"Request\\nBuyer -> Seller\"];",
+		"a2 -> a3 [label=\"ID, item\"];",
+		"a3 -> a0 [label=\"price\"];",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("Missing '%s' in:\n%s", expected, out)
+		}
+	}
+}
+
+func TestMermaidFlowchart(t *testing.T) {
+	var sb strings.Builder
+	if err := MermaidFlowchart(&sb, testProtocol()); err != nil {
+		t.Fatal(err)
+	}
+	out := sb.String()
+	for _, expected := range []string{
+		"flowchart TD",
+		"a3[\"Offer<br/>Seller -> Buyer\"]",
+		"a3 -->|price| a1",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("Missing '%s' in:\n%s", expected, out)
+		}
+	}
+}
+
+func TestEnactment(t *testing.T) {
+	order := Enactment(testProtocol())
+	expected := []string{"Request", "Offer", "Accept"}
+	if len(order) != len(expected) {
+		t.Fatalf("Unexpected enactment: %v", order)
+	}
+	for i, a := range order {
+		if a.Name != expected[i] {
+			t.Fatalf("Unexpected enactment: %v", order)
+		}
+	}
+}
+
+func TestSequence(t *testing.T) {
+	var mermaid, plantuml strings.Builder
+	if err := MermaidSequence(&mermaid, testProtocol()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(mermaid.String(), "Seller->>Buyer: Offer(ID, item, price)") {
+		t.Fatal(mermaid.String())
+	}
+	if err := PlantUMLSequence(&plantuml, testProtocol()); err != nil {
+		t.Fatal(err)
+	}
+	out := plantuml.String()
+	if !strings.HasPrefix(out, "@startuml Purchase") || !strings.Contains(out, "Buyer -> Seller : Accept(ID, price, decision)") {
+		t.Fatal(out)
+	}
+}
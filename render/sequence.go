@@ -0,0 +1,79 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+// Enactment returns a valid order in which the actions of a protocol can
+// be run. At each step the first enabled action is chosen: the one whose
+// 'in' parameters are known and whose 'out' and 'nil' parameters are not.
+func Enactment(p proto.Protocol) []proto.Action {
+	bound := make(map[string]bool)
+	order := make([]proto.Action, 0)
+	for {
+		next := -1
+		for i, a := range p.Actions {
+			if enabled(a, bound) {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			return order
+		}
+		a := p.Actions[next]
+		for _, param := range a.Outs() {
+			bound[param.Name] = true
+		}
+		order = append(order, a)
+	}
+}
+
+func enabled(a proto.Action, bound map[string]bool) bool {
+	for _, param := range a.Params {
+		if bound[param.Name] != (param.Io == proto.In) {
+			return false
+		}
+	}
+	return true
+}
+
+// MermaidSequence writes one valid enactment of a protocol as a Mermaid
+// sequence diagram.
+func MermaidSequence(w io.Writer, p proto.Protocol) error {
+	var sb strings.Builder
+	sb.WriteString("sequenceDiagram\n")
+	for _, r := range p.Roles {
+		sb.WriteString(fmt.Sprintf("\tparticipant %s\n", r))
+	}
+	for _, a := range Enactment(p) {
+		sb.WriteString(fmt.Sprintf("\t%s->>%s: %s\n", a.From, a.To, message(a)))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// PlantUMLSequence writes one valid enactment of a protocol as a PlantUML
+// sequence diagram.
+func PlantUMLSequence(w io.Writer, p proto.Protocol) error {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("@startuml %s\n", p.Name))
+	for _, r := range p.Roles {
+		sb.WriteString(fmt.Sprintf("participant %s\n", r))
+	}
+	for _, a := range Enactment(p) {
+		sb.WriteString(fmt.Sprintf("%s -> %s : %s\n", a.From, a.To, message(a)))
+	}
+	sb.WriteString("@enduml\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// message describes an action and the parameters it carries
+func message(a proto.Action) string {
+	return a.Name + "(" + paramNames(a.Params) + ")"
+}
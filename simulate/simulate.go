@@ -0,0 +1,438 @@
+// Package simulate enacts protocols on implementation.Instance, picking
+// enabled actions at random or exploring every interleaving, to find
+// deadlocks and unsafe conflicts before a protocol is deployed.
+package simulate
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/mikelsr/bspl/implementation"
+	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/reason"
+)
+
+// Strategy used to pick the next action of an enactment
+type Strategy string
+
+const (
+	// Random picks one of the enabled actions at random
+	Random Strategy = "random"
+	// Exhaustive explores every interleaving of the enabled actions
+	// breadth-first, visiting each reachable state once
+	Exhaustive Strategy = "bfs"
+)
+
+// Outcome of an enactment
+type Outcome string
+
+const (
+	// Completed enactments bound every 'out' parameter of the protocol
+	Completed Outcome = "completed"
+	// Deadlock is reached when no action is enabled before completing
+	Deadlock Outcome = "deadlock"
+	// Truncated enactments reached the maximum number of steps
+	Truncated Outcome = "truncated"
+)
+
+const (
+	// DefaultRuns of the Random strategy
+	DefaultRuns = 100
+	// DefaultMaxSteps of an enactment
+	DefaultMaxSteps = 100
+	// DefaultMaxTraces explored by the Exhaustive strategy
+	DefaultMaxTraces = 1000
+	// DefaultMaxStates explored by the Exhaustive strategy
+	DefaultMaxStates = 100000
+)
+
+// Options of a simulation, zero values use the defaults
+type Options struct {
+	Strategy Strategy
+	// Seed of the Random strategy
+	Seed int64
+	// Runs of the Random strategy
+	Runs int
+	// MaxSteps of each enactment
+	MaxSteps int
+	// MaxTraces explored by the Exhaustive strategy
+	MaxTraces int
+	// MaxStates explored by the Exhaustive strategy
+	MaxStates int
+}
+
+// Step of an enactment: a message sent from a role to another
+type Step struct {
+	Action string        `json:"action"`
+	From   proto.Role    `json:"from"`
+	To     proto.Role    `json:"to"`
+	Values reason.Values `json:"values"`
+}
+
+func (s Step) String() string {
+	names := make([]string, 0, len(s.Values))
+	for name := range s.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = name + "=" + s.Values[name]
+	}
+	return fmt.Sprintf("%s -> %s: %s[%s]", s.From, s.To, s.Action, strings.Join(values, ", "))
+}
+
+// Trace of an enactment
+type Trace struct {
+	Steps   []Step  `json:"steps"`
+	Outcome Outcome `json:"outcome"`
+}
+
+// Conflict between actions sent by different roles that may bind the same
+// parameter in the same state, so the roles may disagree on its value
+type Conflict struct {
+	Param   string   `json:"parameter"`
+	Actions []string `json:"actions"`
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("'%s' may be bound by %s", c.Param, strings.Join(c.Actions, " and "))
+}
+
+// Report of a simulation
+type Report struct {
+	Protocol  string     `json:"protocol"`
+	Strategy  Strategy   `json:"strategy"`
+	Runs      int        `json:"runs"`
+	Completed int        `json:"completed"`
+	Deadlocks int        `json:"deadlocks"`
+	Truncated int        `json:"truncated"`
+	Conflicts []Conflict `json:"conflicts"`
+	Traces    []Trace    `json:"traces"`
+	// Incomplete is true if the Exhaustive strategy stopped at MaxTraces
+	// or MaxStates
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// CompletionRate returns the fraction of the runs that completed
+func (r Report) CompletionRate() float64 {
+	if r.Runs == 0 {
+		return 0
+	}
+	return float64(r.Completed) / float64(r.Runs)
+}
+
+// Run simulates enactments of a protocol. Each role is played by an agent
+// named after it, the inputs of the protocol and the outputs of the
+// actions are bound to fake values, and each action runs at most once per
+// enactment.
+func Run(p proto.Protocol, opts Options) (Report, error) {
+	if err := proto.Validate(p); err != nil {
+		return Report{}, err
+	}
+	if opts.Runs <= 0 {
+		opts.Runs = DefaultRuns
+	}
+	if opts.MaxSteps <= 0 {
+		opts.MaxSteps = DefaultMaxSteps
+	}
+	if opts.MaxTraces <= 0 {
+		opts.MaxTraces = DefaultMaxTraces
+	}
+	if opts.MaxStates <= 0 {
+		opts.MaxStates = DefaultMaxStates
+	}
+	s := &simulation{p: p, opts: opts, conflicts: make(map[string]Conflict)}
+	r := Report{Protocol: p.Name, Strategy: opts.Strategy, Traces: []Trace{}}
+	var err error
+	switch opts.Strategy {
+	case Random, "":
+		r.Strategy = Random
+		err = s.random(&r)
+	case Exhaustive:
+		err = s.exhaustive(&r)
+	default:
+		return Report{}, fmt.Errorf("Unknown strategy: %s", opts.Strategy)
+	}
+	if err != nil {
+		return Report{}, err
+	}
+	for _, t := range r.Traces {
+		switch t.Outcome {
+		case Completed:
+			r.Completed++
+		case Deadlock:
+			r.Deadlocks++
+		case Truncated:
+			r.Truncated++
+		}
+	}
+	r.Runs = len(r.Traces)
+	r.Conflicts = s.sortedConflicts()
+	return r, nil
+}
+
+// simulation holds the state shared by the enactments of a protocol
+type simulation struct {
+	p         proto.Protocol
+	opts      Options
+	conflicts map[string]Conflict
+}
+
+// state of an enactment
+type state struct {
+	i     *implementation.Instance
+	steps []Step
+	// ran actions by index
+	ran map[int]bool
+	// bindings of the action parameters the protocol does not declare,
+	// which the instance ignores
+	undeclared reason.Values
+}
+
+// value of a parameter in a state
+func (st state) value(name string) string {
+	if v, found := st.undeclared[name]; found {
+		return v
+	}
+	return st.i.GetValue(name)
+}
+
+// enables returns true if the 'in' parameters of an action are bound in a
+// state and its other parameters are not
+func (st state) enables(a proto.Action) bool {
+	for _, param := range a.Params {
+		if bound := st.value(param.Name) != ""; bound != (param.Io == proto.In) {
+			return false
+		}
+	}
+	return true
+}
+
+// id of a state by its bindings and ran actions
+func (st state) id() string {
+	ran := make([]int, 0, len(st.ran))
+	for j := range st.ran {
+		ran = append(ran, j)
+	}
+	sort.Ints(ran)
+	bindings := make([]string, 0, len(st.undeclared))
+	for k, v := range st.undeclared {
+		bindings = append(bindings, k+"="+v)
+	}
+	for _, param := range st.i.Protocol().Params {
+		if v := st.i.GetValue(param.Name); v != "" {
+			bindings = append(bindings, param.Name+"="+v)
+		}
+	}
+	sort.Strings(bindings)
+	return fmt.Sprint(ran, bindings)
+}
+
+func (s *simulation) start(run int) (state, error) {
+	roles := make(reason.Roles, len(s.p.Roles))
+	for _, r := range s.p.Roles {
+		roles[r] = string(r)
+	}
+	ins := make(reason.Values)
+	for _, in := range s.p.Ins() {
+		ins[in.Name] = fakeValue(in, run)
+	}
+	i, err := implementation.Instantiate(s.p, roles, nil, ins)
+	if err != nil {
+		return state{}, err
+	}
+	return state{i: i, steps: []Step{}, ran: make(map[int]bool),
+		undeclared: make(reason.Values)}, nil
+}
+
+// enabled returns the indexes of the actions that can run in a state and
+// records the conflicts between them
+func (s *simulation) enabled(st state) []int {
+	enabled := make([]int, 0)
+	for j, a := range s.p.Actions {
+		if !st.ran[j] && st.enables(a) {
+			enabled = append(enabled, j)
+		}
+	}
+	for x, j := range enabled {
+		for _, k := range enabled[x+1:] {
+			s.conflict(s.p.Actions[j], s.p.Actions[k])
+		}
+	}
+	return enabled
+}
+
+func (s *simulation) conflict(a, b proto.Action) {
+	if a.From == b.From {
+		// the sender chooses one of them
+		return
+	}
+	for _, x := range a.Outs() {
+		for _, y := range b.Outs() {
+			if x.Name != y.Name {
+				continue
+			}
+			names := []string{a.Name, b.Name}
+			sort.Strings(names)
+			c := Conflict{Param: x.Name, Actions: names}
+			s.conflicts[c.String()] = c
+		}
+	}
+}
+
+func (s *simulation) sortedConflicts() []Conflict {
+	keys := make([]string, 0, len(s.conflicts))
+	for k := range s.conflicts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	conflicts := make([]Conflict, len(keys))
+	for i, k := range keys {
+		conflicts[i] = s.conflicts[k]
+	}
+	return conflicts
+}
+
+// step runs an action on a copy of the state
+func (s *simulation) step(st state, j int, run int) (state, error) {
+	a := s.p.Actions[j]
+	next := state{i: clone(st.i), ran: make(map[int]bool, len(st.ran)+1),
+		undeclared: make(reason.Values, len(st.undeclared))}
+	for k := range st.ran {
+		next.ran[k] = true
+	}
+	next.ran[j] = true
+	for k, v := range st.undeclared {
+		next.undeclared[k] = v
+	}
+	values := make(reason.Values, len(a.Params))
+	for _, param := range a.Params {
+		switch param.Io {
+		case proto.In:
+			values[param.Name] = st.value(param.Name)
+		case proto.Out:
+			declared, found := s.p.Param(param.Name)
+			if !found {
+				v := fakeValue(param, run)
+				next.undeclared[param.Name] = v
+				values[param.Name] = v
+				continue
+			}
+			v := fakeValue(declared, run)
+			if err := next.i.SetValue(param.Name, v); err != nil {
+				return state{}, err
+			}
+			values[param.Name] = v
+		}
+	}
+	next.steps = append(append([]Step(nil), st.steps...),
+		Step{Action: a.Name, From: a.From, To: a.To, Values: values})
+	return next, nil
+}
+
+// outcome of a state without enabled actions or steps left, ok is false
+// if the enactment may go on
+func (s *simulation) outcome(st state, enabled []int) (Outcome, bool) {
+	if reason.Complete(st.i) {
+		return Completed, true
+	}
+	if len(enabled) == 0 {
+		return Deadlock, true
+	}
+	if len(st.steps) >= s.opts.MaxSteps {
+		return Truncated, true
+	}
+	return "", false
+}
+
+func (s *simulation) random(r *Report) error {
+	rnd := rand.New(rand.NewSource(s.opts.Seed))
+	for run := 0; run < s.opts.Runs; run++ {
+		st, err := s.start(run)
+		if err != nil {
+			return err
+		}
+		for {
+			enabled := s.enabled(st)
+			if o, done := s.outcome(st, enabled); done {
+				r.Traces = append(r.Traces, Trace{Steps: st.steps, Outcome: o})
+				break
+			}
+			if st, err = s.step(st, enabled[rnd.Intn(len(enabled))], run); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *simulation) exhaustive(r *Report) error {
+	initial, err := s.start(0)
+	if err != nil {
+		return err
+	}
+	// interleavings reaching the same state are explored once
+	visited := map[string]bool{initial.id(): true}
+	queue := []state{initial}
+	for len(queue) > 0 {
+		if len(r.Traces) >= s.opts.MaxTraces {
+			r.Incomplete = true
+			return nil
+		}
+		st := queue[0]
+		queue = queue[1:]
+		enabled := s.enabled(st)
+		if o, done := s.outcome(st, enabled); done {
+			r.Traces = append(r.Traces, Trace{Steps: st.steps, Outcome: o})
+			continue
+		}
+		for _, j := range enabled {
+			next, err := s.step(st, j, 0)
+			if err != nil {
+				return err
+			}
+			id := next.id()
+			if visited[id] {
+				continue
+			}
+			if len(visited) >= s.opts.MaxStates {
+				r.Incomplete = true
+				continue
+			}
+			visited[id] = true
+			queue = append(queue, next)
+		}
+	}
+	return nil
+}
+
+// clone copies the bindings of an instance
+func clone(i *implementation.Instance) *implementation.Instance {
+	c := implementation.NewInstance(i.Protocol(), i.Roles())
+	for _, param := range i.Protocol().Params {
+		if v := i.GetValue(param.Name); v != "" {
+			// values were checked when they were set
+			c.SetValue(param.Name, v)
+		}
+	}
+	return c
+}
+
+// fakeValue returns a value of the type of a parameter, distinct for each
+// run
+func fakeValue(param proto.Parameter, run int) string {
+	switch param.Type {
+	case proto.Int:
+		return fmt.Sprint(run + 1)
+	case proto.Decimal:
+		return fmt.Sprintf("%d.50", run+1)
+	case proto.Bool:
+		return "true"
+	case proto.Time:
+		return fmt.Sprintf("2020-01-01T00:00:%02dZ", run%60)
+	}
+	return fmt.Sprintf("%s-%d", param.Name, run+1)
+}
@@ -0,0 +1,169 @@
+package simulate
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/mikelsr/bspl/parser"
+	"github.com/mikelsr/bspl/proto"
+)
+
+func testProtocol() proto.Protocol {
+	buyer := proto.Role("Buyer")
+	seller := proto.Role("Seller")
+	return proto.Protocol{
+		Name:  "Purchase",
+		Roles: []proto.Role{buyer, seller},
+		Params: []proto.Parameter{
+			{Name: "ID", Key: true, Io: proto.Out, Type: proto.Int},
+			{Name: "item", Io: proto.Out},
+			{Name: "price", Io: proto.Out, Type: proto.Decimal},
+			{Name: "decision", Io: proto.Out},
+		},
+		Actions: []proto.Action{
+			{Name: "Request", From: buyer, To: seller, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.Out},
+				{Name: "item", Io: proto.Out},
+			}},
+			{Name: "Offer", From: seller, To: buyer, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "item", Io: proto.In},
+				{Name: "price", Io: proto.Out},
+			}},
+			{Name: "Accept", From: buyer, To: seller, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "price", Io: proto.In},
+				{Name: "decision", Io: proto.Out},
+			}},
+			{Name: "Reject", From: buyer, To: seller, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "price", Io: proto.In},
+				{Name: "decision", Io: proto.Out},
+			}},
+		},
+	}
+}
+
+func TestRun_Random(t *testing.T) {
+	opts := Options{Strategy: Random, Seed: 1, Runs: 20}
+	r, err := Run(testProtocol(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Runs != 20 || r.Completed != 20 || r.CompletionRate() != 1 || len(r.Conflicts) != 0 {
+		t.Fatalf("Unexpected report: %+v", r)
+	}
+	steps := r.Traces[0].Steps
+	if len(steps) != 3 || steps[0].Action != "Request" || steps[1].Values["price"] != "1.50" {
+		t.Fatalf("Unexpected trace: %v", steps)
+	}
+	// the same seed produces the same traces
+	again, _ := Run(testProtocol(), opts)
+	if !reflect.DeepEqual(r, again) {
+		t.Fatal("Simulation is not deterministic")
+	}
+}
+
+func TestRun_Exhaustive(t *testing.T) {
+	r, err := Run(testProtocol(), Options{Strategy: Exhaustive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Accept or Reject
+	if r.Runs != 2 || r.Completed != 2 || r.Incomplete {
+		t.Fatalf("Unexpected report: %+v", r)
+	}
+	if r, _ = Run(testProtocol(), Options{Strategy: Exhaustive, MaxTraces: 1}); !r.Incomplete {
+		t.Fatal("Exploration not bounded")
+	}
+	if r, _ = Run(testProtocol(), Options{Strategy: Exhaustive, MaxStates: 2}); !r.Incomplete ||
+		r.Runs != 0 {
+		t.Fatalf("States not bounded: %+v", r)
+	}
+}
+
+func TestRun_ExhaustiveVisited(t *testing.T) {
+	p := testProtocol()
+	// both roles may tag the offer in any order
+	for _, tag := range []struct {
+		name string
+		from proto.Role
+		to   proto.Role
+	}{{"BuyerTag", "Buyer", "Seller"}, {"SellerTag", "Seller", "Buyer"}} {
+		p.Params = append(p.Params, proto.Parameter{Name: tag.name, Io: proto.Out})
+		p.Actions = append(p.Actions, proto.Action{Name: tag.name, From: tag.from, To: tag.to,
+			Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "price", Io: proto.In},
+				{Name: tag.name, Io: proto.Out},
+			}})
+	}
+	r, err := Run(p, Options{Strategy: Exhaustive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the interleavings of the tags and the decision end in the same
+	// states: Accept or Reject with both tags
+	if r.Runs != 2 || r.Completed != 2 || r.Incomplete {
+		t.Fatalf("Unexpected report: %+v", r)
+	}
+}
+
+func TestRun_Undeclared(t *testing.T) {
+	f, err := os.Open("../test/samples/example_1.bspl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, err := parser.Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Accept binds address, which enables Deliver, which binds dropOff,
+	// which enables Payment
+	for _, opts := range []Options{{Strategy: Random, Seed: 1}, {Strategy: Exhaustive}} {
+		r, err := Run(p, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Deadlocks != 0 || r.CompletionRate() != 1 {
+			t.Fatalf("Unexpected report: %+v", r)
+		}
+	}
+	r, _ := Run(p, Options{Strategy: Exhaustive})
+	steps := r.Traces[1].Steps
+	if len(steps) != 5 || steps[4].Action != "Payment" || steps[4].Values["dropOff"] != "dropOff-1" {
+		t.Fatalf("Unexpected trace: %v", steps)
+	}
+}
+
+func TestRun_Problems(t *testing.T) {
+	p := testProtocol()
+	// the seller may cancel while the buyer decides
+	p.Actions = append(p.Actions, proto.Action{Name: "Cancel", From: "Seller", To: "Buyer",
+		Params: []proto.Parameter{
+			{Name: "ID", Key: true, Io: proto.In},
+			{Name: "price", Io: proto.In},
+			{Name: "decision", Io: proto.Out},
+		}})
+	// and nobody sends the receipt
+	p.Params = append(p.Params, proto.Parameter{Name: "receipt", Io: proto.Out})
+	r, err := Run(p, Options{Strategy: Exhaustive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Runs != 3 || r.Deadlocks != 3 || r.CompletionRate() != 0 {
+		t.Fatalf("Unexpected report: %+v", r)
+	}
+	expected := []Conflict{
+		{Param: "decision", Actions: []string{"Accept", "Cancel"}},
+		{Param: "decision", Actions: []string{"Cancel", "Reject"}},
+	}
+	if !reflect.DeepEqual(r.Conflicts, expected) {
+		t.Fatalf("Unexpected conflicts: %v", r.Conflicts)
+	}
+	if _, err := Run(p, Options{Strategy: "dfs"}); err == nil {
+		t.Fatal("Accepted unknown strategy")
+	}
+}
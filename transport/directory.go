@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/reason"
+)
+
+// Directory maps the roles of a protocol to the addresses of the
+// endpoints playing them
+type Directory struct {
+	mu    sync.RWMutex
+	addrs map[proto.Role]string
+}
+
+// NewDirectory creates a Directory from the roles of an instance. The
+// IDs of the agents assuming the roles are used as their addresses.
+func NewDirectory(roles reason.Roles) *Directory {
+	d := &Directory{addrs: make(map[proto.Role]string)}
+	for role, addr := range roles {
+		d.addrs[role] = addr
+	}
+	return d
+}
+
+// Lookup the address of a role
+func (d *Directory) Lookup(role proto.Role) (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	addr, found := d.addrs[role]
+	if !found {
+		return "", fmt.Errorf("No address for role: %s", role)
+	}
+	return addr, nil
+}
+
+// Set the address of a role
+func (d *Directory) Set(role proto.Role, addr string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addrs[role] = addr
+}
+
+// Roles returns the directory as reason.Roles
+func (d *Directory) Roles() reason.Roles {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	roles := make(reason.Roles)
+	for role, addr := range d.addrs {
+		roles[role] = addr
+	}
+	return roles
+}
+
+// SendTo sends a payload to the endpoint playing a role
+func SendTo(t Transport, d *Directory, role proto.Role, payload []byte) error {
+	addr, err := d.Lookup(role)
+	if err != nil {
+		return err
+	}
+	return t.Send(addr, payload)
+}
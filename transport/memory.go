@@ -0,0 +1,120 @@
+package transport
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	// memoryBuffer is the number of messages an in-memory endpoint
+	// holds before Send blocks
+	memoryBuffer = 64
+)
+
+// Network connects in-memory endpoints, it is meant for tests and
+// agents running in the same process
+type Network struct {
+	mu        sync.RWMutex
+	endpoints map[string]*MemoryTransport
+}
+
+// NewNetwork is the default constructor for Network.
+func NewNetwork() *Network {
+	return &Network{endpoints: make(map[string]*MemoryTransport)}
+}
+
+// Listen creates an endpoint reachable at addr
+func (n *Network) Listen(addr string) (*MemoryTransport, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, found := n.endpoints[addr]; found {
+		return nil, fmt.Errorf("Address already in use: '%s'", addr)
+	}
+	t := &MemoryTransport{
+		network: n,
+		addr:    addr,
+		inbox:   make(chan Message, memoryBuffer),
+		done:    make(chan struct{}),
+	}
+	n.endpoints[addr] = t
+	return t, nil
+}
+
+// MemoryTransport is a Transport backed by channels
+type MemoryTransport struct {
+	network *Network
+	addr    string
+
+	mu     sync.RWMutex
+	closed bool
+	inbox  chan Message
+	// done is closed with the endpoint to release blocked senders
+	done chan struct{}
+	// senders blocked on the inbox, which is closed once they return
+	senders sync.WaitGroup
+}
+
+// Addr returns the address other endpoints use to reach this one.
+func (t *MemoryTransport) Addr() string {
+	return t.addr
+}
+
+// Close the endpoint and remove it from its Network.
+func (t *MemoryTransport) Close() error {
+	t.network.mu.Lock()
+	delete(t.network.endpoints, t.addr)
+	t.network.mu.Unlock()
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return ErrClosed
+	}
+	t.closed = true
+	close(t.done)
+	t.mu.Unlock()
+	t.senders.Wait()
+	close(t.inbox)
+	return nil
+}
+
+// Receive returns the stream of incoming messages.
+func (t *MemoryTransport) Receive() <-chan Message {
+	return t.inbox
+}
+
+// Send a payload to the endpoint at the given address.
+func (t *MemoryTransport) Send(to string, payload []byte) error {
+	t.mu.RLock()
+	closed := t.closed
+	t.mu.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+	t.network.mu.RLock()
+	dst, found := t.network.endpoints[to]
+	t.network.mu.RUnlock()
+	if !found {
+		return fmt.Errorf("Unknown address: '%s'", to)
+	}
+	return dst.deliver(Message{From: t.addr, Payload: append([]byte(nil), payload...)})
+}
+
+// deliver a message to the inbox of the endpoint, blocking while it is
+// full until it is read or the endpoint is closed
+func (t *MemoryTransport) deliver(m Message) error {
+	t.mu.RLock()
+	if t.closed {
+		t.mu.RUnlock()
+		return ErrClosed
+	}
+	t.senders.Add(1)
+	t.mu.RUnlock()
+	defer t.senders.Done()
+	select {
+	case t.inbox <- m:
+		return nil
+	case <-t.done:
+		return ErrClosed
+	}
+}
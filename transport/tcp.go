@@ -0,0 +1,228 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxFrameSize is the largest frame accepted by TCPTransport
+	MaxFrameSize = 16 << 20
+	// tcpBuffer is the number of received messages held before
+	// connections stop being read
+	tcpBuffer = 64
+	// DialTimeout is the time TCPTransport waits to connect to a peer
+	DialTimeout = 10 * time.Second
+)
+
+// TCPTransport is a Transport that sends length-prefixed frames over TCP.
+// Each frame is a big-endian uint32 length followed by the address of
+// the sender (uint16 length and bytes) and the payload.
+type TCPTransport struct {
+	listener net.Listener
+	inbox    chan Message
+	done     chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+	conns  map[string]*tcpConn
+	// accepted connections, closed with the transport
+	accepted map[net.Conn]struct{}
+	wg       sync.WaitGroup
+}
+
+// ListenTCP creates a TCPTransport listening on addr, e.g. "127.0.0.1:0"
+func ListenTCP(addr string) (*TCPTransport, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	t := &TCPTransport{
+		listener: l,
+		inbox:    make(chan Message, tcpBuffer),
+		done:     make(chan struct{}),
+		conns:    make(map[string]*tcpConn),
+		accepted: make(map[net.Conn]struct{}),
+	}
+	t.wg.Add(1)
+	go t.accept()
+	return t, nil
+}
+
+// Addr returns the address other endpoints use to reach this one.
+func (t *TCPTransport) Addr() string {
+	return t.listener.Addr().String()
+}
+
+// Close the listener and every open connection.
+func (t *TCPTransport) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return ErrClosed
+	}
+	t.closed = true
+	close(t.done)
+	err := t.listener.Close()
+	for _, c := range t.conns {
+		c.Close()
+	}
+	for c := range t.accepted {
+		c.Close()
+	}
+	t.mu.Unlock()
+	t.wg.Wait()
+	close(t.inbox)
+	return err
+}
+
+// Receive returns the stream of incoming messages.
+func (t *TCPTransport) Receive() <-chan Message {
+	return t.inbox
+}
+
+// tcpConn is an outgoing connection, writes to it are serialized
+type tcpConn struct {
+	net.Conn
+	mu sync.Mutex
+}
+
+// Send a payload to the endpoint at the given address. Connections are
+// reused between calls. Sends to different peers don't wait for each
+// other.
+func (t *TCPTransport) Send(to string, payload []byte) error {
+	frame, err := encodeFrame(t.Addr(), payload)
+	if err != nil {
+		return err
+	}
+	c, err := t.conn(to)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	_, err = c.Write(frame)
+	c.mu.Unlock()
+	if err != nil {
+		// drop the broken connection so the next Send redials
+		c.Close()
+		t.mu.Lock()
+		if t.conns[to] == c {
+			delete(t.conns, to)
+		}
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// conn returns the connection to a peer, dialing it without holding t.mu
+func (t *TCPTransport) conn(to string) (*tcpConn, error) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil, ErrClosed
+	}
+	c, found := t.conns[to]
+	t.mu.Unlock()
+	if found {
+		return c, nil
+	}
+	nc, err := net.DialTimeout("tcp", to, DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		nc.Close()
+		return nil, ErrClosed
+	}
+	// another Send may have connected meanwhile
+	if c, found := t.conns[to]; found {
+		nc.Close()
+		return c, nil
+	}
+	c = &tcpConn{Conn: nc}
+	t.conns[to] = c
+	return c, nil
+}
+
+func (t *TCPTransport) accept() {
+	defer t.wg.Done()
+	for {
+		c, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		t.mu.Lock()
+		if t.closed {
+			t.mu.Unlock()
+			c.Close()
+			return
+		}
+		t.accepted[c] = struct{}{}
+		t.wg.Add(1)
+		t.mu.Unlock()
+		go t.read(c)
+	}
+}
+
+func (t *TCPTransport) read(c net.Conn) {
+	defer t.wg.Done()
+	defer func() {
+		t.mu.Lock()
+		delete(t.accepted, c)
+		t.mu.Unlock()
+		c.Close()
+	}()
+	r := bufio.NewReader(c)
+	for {
+		m, err := decodeFrame(r)
+		if err != nil {
+			return
+		}
+		select {
+		case t.inbox <- m:
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func encodeFrame(from string, payload []byte) ([]byte, error) {
+	size := 2 + len(from) + len(payload)
+	if size > MaxFrameSize || len(from) > 0xffff {
+		return nil, fmt.Errorf("Frame too large: %d bytes", size)
+	}
+	frame := make([]byte, 4+size)
+	binary.BigEndian.PutUint32(frame, uint32(size))
+	binary.BigEndian.PutUint16(frame[4:], uint16(len(from)))
+	copy(frame[6:], from)
+	copy(frame[6+len(from):], payload)
+	return frame, nil
+}
+
+func decodeFrame(r io.Reader) (Message, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Message{}, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size < 2 || size > MaxFrameSize {
+		return Message{}, fmt.Errorf("Invalid frame size: %d bytes", size)
+	}
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return Message{}, err
+	}
+	n := int(binary.BigEndian.Uint16(frame))
+	if 2+n > len(frame) {
+		return Message{}, fmt.Errorf("Invalid sender length: %d bytes", n)
+	}
+	return Message{From: string(frame[2 : 2+n]), Payload: frame[2+n:]}, nil
+}
@@ -0,0 +1,29 @@
+package transport
+
+import "errors"
+
+var (
+	// ErrClosed is returned when using a closed Transport
+	ErrClosed = errors.New("Transport closed")
+)
+
+// Message received by a Transport
+type Message struct {
+	// From is the address of the sender
+	From string
+	// Payload of the message
+	Payload []byte
+}
+
+// Transport delivers messages between the endpoints playing the roles
+// of a protocol
+type Transport interface {
+	// Addr returns the address other endpoints use to reach this one.
+	Addr() string
+	// Close the endpoint. The Receive channel is closed afterwards.
+	Close() error
+	// Receive returns the stream of incoming messages.
+	Receive() <-chan Message
+	// Send a payload to the endpoint at the given address.
+	Send(to string, payload []byte) error
+}
@@ -0,0 +1,130 @@
+package transport
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mikelsr/bspl/proto"
+	"github.com/mikelsr/bspl/reason"
+)
+
+// testExchange sends a message from a to b and a reply from b to a
+func testExchange(t *testing.T, a, b Transport) {
+	d := NewDirectory(reason.Roles{
+		proto.Role("Buyer"):  a.Addr(),
+		proto.Role("Seller"): b.Addr(),
+	})
+	if err := SendTo(a, d, "Seller", []byte("request")); err != nil {
+		t.Fatal(err)
+	}
+	m := receive(t, b)
+	if m.From != a.Addr() || !bytes.Equal(m.Payload, []byte("request")) {
+		t.Fatalf("Unexpected message: %v", m)
+	}
+	if err := b.Send(m.From, []byte("offer")); err != nil {
+		t.Fatal(err)
+	}
+	m = receive(t, a)
+	if m.From != b.Addr() || !bytes.Equal(m.Payload, []byte("offer")) {
+		t.Fatalf("Unexpected message: %v", m)
+	}
+	if err := SendTo(a, d, "Shipper", nil); err == nil {
+		t.Fatal("Sent message to unknown role")
+	}
+	for _, x := range []Transport{a, b} {
+		if err := x.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, open := <-x.Receive(); open {
+			t.Fatal("Receive channel open after Close")
+		}
+		if err := x.Send(b.Addr(), nil); err != ErrClosed {
+			t.Fatal("Sent message from closed transport")
+		}
+	}
+}
+
+func receive(t *testing.T, x Transport) Message {
+	select {
+	case m := <-x.Receive():
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for message")
+	}
+	return Message{}
+}
+
+func TestMemoryTransport(t *testing.T) {
+	n := NewNetwork()
+	a, err := n.Listen("buyer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := n.Listen("seller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.Listen("seller"); err == nil {
+		t.Fatal("Listened twice on the same address")
+	}
+	if err := a.Send("nobody", nil); err == nil {
+		t.Fatal("Sent message to unknown address")
+	}
+	testExchange(t, a, b)
+}
+
+func TestTCPTransport(t *testing.T) {
+	a, err := ListenTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ListenTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testExchange(t, a, b)
+}
+
+func TestFrame(t *testing.T) {
+	frame, err := encodeFrame("from", []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := decodeFrame(bytes.NewReader(frame))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.From != "from" || string(m.Payload) != "payload" {
+		t.Fatalf("Unexpected message: %v", m)
+	}
+	if _, err := decodeFrame(bytes.NewReader(frame[:len(frame)-1])); err == nil {
+		t.Fatal("Decoded truncated frame")
+	}
+	if _, err := encodeFrame("", make([]byte, MaxFrameSize)); err == nil {
+		t.Fatal("Encoded oversized frame")
+	}
+}
+
+func TestMemoryTransport_CloseFull(t *testing.T) {
+	n := NewNetwork()
+	a, _ := n.Listen("buyer")
+	b, _ := n.Listen("seller")
+	for x := 0; x < memoryBuffer; x++ {
+		if err := a.Send("seller", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the inbox is full and nobody reads it
+	blocked := make(chan error)
+	go func() { blocked <- a.Send("seller", nil) }()
+	closed := make(chan error)
+	go func() { closed <- b.Close() }()
+	for _, c := range []chan error{closed, blocked} {
+		select {
+		case <-c:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Close blocked by a full inbox")
+		}
+	}
+}
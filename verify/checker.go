@@ -0,0 +1,177 @@
+// Package verify is an explicit-state model checker of BSPL protocols.
+// States hold the local view of each role, which only learns a binding
+// when it sends or receives the message carrying it, and messages are
+// delivered asynchronously in any order.
+package verify
+
+import (
+	"fmt"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+// DefaultMaxStates explored by Check
+const DefaultMaxStates = 100000
+
+// EventKind states whether a message was sent or received
+type EventKind string
+
+const (
+	// Send of a message by its sender
+	Send EventKind = "send"
+	// Receive of a message by its recipient
+	Receive EventKind = "receive"
+)
+
+// Event of a trace
+type Event struct {
+	Kind   EventKind  `json:"kind"`
+	Action string     `json:"action"`
+	From   proto.Role `json:"from"`
+	To     proto.Role `json:"to"`
+}
+
+func (e Event) String() string {
+	if e.Kind == Send {
+		return fmt.Sprintf("%s sends %s to %s", e.From, e.Action, e.To)
+	}
+	return fmt.Sprintf("%s receives %s from %s", e.To, e.Action, e.From)
+}
+
+// Options of Check, zero values use the defaults
+type Options struct {
+	// MaxStates explored before giving up
+	MaxStates int
+}
+
+// Result of checking a property
+type Result struct {
+	Property string `json:"property"`
+	Scope    Scope  `json:"scope"`
+	Holds    bool   `json:"holds"`
+	// Counterexample is a shortest trace to a state violating the property
+	Counterexample []Event `json:"counterexample,omitempty"`
+}
+
+// Report of a model check
+type Report struct {
+	Protocol string `json:"protocol"`
+	// States is the number of distinct states explored
+	States int `json:"states"`
+	// Incomplete is true if the exploration stopped at MaxStates, the
+	// properties that hold may be violated by unexplored states
+	Incomplete bool     `json:"incomplete,omitempty"`
+	Results    []Result `json:"results"`
+}
+
+// Holds returns true if every property holds
+func (r Report) Holds() bool {
+	for _, res := range r.Results {
+		if !res.Holds {
+			return false
+		}
+	}
+	return true
+}
+
+// node of the explored state graph, states are only kept by hash
+type node struct {
+	parent uint64
+	event  Event
+	root   bool
+}
+
+// Check explores the state space of a protocol breadth-first and checks
+// the properties in every reachable state. States are identified by the
+// hash of their canonical encoding.
+func Check(p proto.Protocol, props []Property, opts Options) (Report, error) {
+	if err := proto.Validate(p); err != nil {
+		return Report{}, err
+	}
+	if opts.MaxStates <= 0 {
+		opts.MaxStates = DefaultMaxStates
+	}
+	r := Report{Protocol: p.Name, Results: make([]Result, len(props))}
+	for i, prop := range props {
+		if prop.Holds == nil {
+			return Report{}, fmt.Errorf("Property '%s' without predicate", prop.Name)
+		}
+		r.Results[i] = Result{Property: prop.Name, Scope: prop.Scope, Holds: true}
+	}
+	initial := initialState(&p)
+	h := initial.hash()
+	visited := map[uint64]node{h: {root: true}}
+	type item struct {
+		s State
+		h uint64
+	}
+	queue := []item{{s: initial, h: h}}
+	pending := len(props)
+	for len(queue) > 0 && pending > 0 {
+		it := queue[0]
+		queue = queue[1:]
+		r.States++
+		successors := it.s.successors()
+		for i, prop := range props {
+			if !r.Results[i].Holds {
+				continue
+			}
+			if prop.Scope == Final && len(successors) > 0 {
+				continue
+			}
+			if !prop.Holds(it.s) {
+				r.Results[i].Holds = false
+				r.Results[i].Counterexample = trace(visited, it.h)
+				pending--
+			}
+		}
+		for _, succ := range successors {
+			sh := succ.s.hash()
+			if _, found := visited[sh]; found {
+				continue
+			}
+			if len(visited) >= opts.MaxStates {
+				r.Incomplete = true
+				continue
+			}
+			visited[sh] = node{parent: it.h, event: succ.e}
+			queue = append(queue, item{s: succ.s, h: sh})
+		}
+	}
+	return r, nil
+}
+
+type successor struct {
+	s State
+	e Event
+}
+
+func (s State) successors() []successor {
+	succs := make([]successor, 0)
+	for _, j := range s.sendable() {
+		a := s.p.Actions[j]
+		succs = append(succs, successor{s: s.send(j),
+			e: Event{Kind: Send, Action: a.Name, From: a.From, To: a.To}})
+	}
+	for j := range s.p.Actions {
+		if _, sent := s.sent[j]; !sent || s.received[j] {
+			continue
+		}
+		a := s.p.Actions[j]
+		succs = append(succs, successor{s: s.receive(j),
+			e: Event{Kind: Receive, Action: a.Name, From: a.From, To: a.To}})
+	}
+	return succs
+}
+
+// trace rebuilds the events from the initial state to a state
+func trace(visited map[uint64]node, h uint64) []Event {
+	events := make([]Event, 0)
+	for n := visited[h]; !n.root; n = visited[n.parent] {
+		events = append(events, n.event)
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events
+}
@@ -0,0 +1,338 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+// Scope of the states a property must hold in
+type Scope string
+
+const (
+	// Always properties must hold in every reachable state
+	Always Scope = "always"
+	// Final properties must hold in every terminal state
+	Final Scope = "final"
+)
+
+// Predicate over a state of an enactment
+type Predicate func(State) bool
+
+// Property of the enactments of a protocol
+type Property struct {
+	Name  string
+	Scope Scope
+	Holds Predicate
+}
+
+// Invariant creates a property that must hold in every reachable state
+func Invariant(name string, holds Predicate) Property {
+	return Property{Name: name, Scope: Always, Holds: holds}
+}
+
+// Eventually creates a property that must hold in every terminal state
+func Eventually(name string, holds Predicate) Property {
+	return Property{Name: name, Scope: Final, Holds: holds}
+}
+
+// Safety is the invariant that roles never disagree on the action that
+// bound a parameter
+func Safety() Property {
+	return Invariant("safety", State.Consistent)
+}
+
+// Liveness is the property that every terminal state is complete
+func Liveness() Property {
+	return Eventually("liveness", State.Complete)
+}
+
+// ParseProperty parses a property of the language:
+//
+//	property := ("always" | "never" | "final") expr
+//	expr     := or ("->" expr)?
+//	or       := and ("||" and)*
+//	and      := unary ("&&" unary)*
+//	unary    := "!" unary | "(" expr ")" | atom
+//	atom     := "sent(" Action ")" | "received(" Action ")" |
+//	            "knows(" Role "," param ")" | "bound(" param ")" |
+//	            "complete" | "true" | "false"
+//
+// "never e" is "always !e". The actions, roles and parameters must be
+// those of the protocol. For example:
+//
+//	never sent(Accept) && sent(Reject)
+//	final sent(Payment) -> sent(Deliver)
+func ParseProperty(p proto.Protocol, src string) (Property, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return Property{}, err
+	}
+	if len(tokens) == 0 {
+		return Property{}, PropertyError{Src: src, Msg: "empty property"}
+	}
+	prop := Property{Name: strings.TrimSpace(src)}
+	negate := false
+	switch tokens[0] {
+	case "always":
+		prop.Scope = Always
+	case "never":
+		prop.Scope = Always
+		negate = true
+	case "final":
+		prop.Scope = Final
+	default:
+		return Property{}, PropertyError{Src: src,
+			Msg: fmt.Sprintf("expected always, never or final, found '%s'", tokens[0])}
+	}
+	ps := &propertyParser{src: src, tokens: tokens[1:], p: &p}
+	pred, err := ps.expr()
+	if err != nil {
+		return Property{}, err
+	}
+	if len(ps.tokens) > 0 {
+		return Property{}, ps.errorf("unexpected '%s'", ps.tokens[0])
+	}
+	if negate {
+		pred = not(pred)
+	}
+	prop.Holds = pred
+	return prop, nil
+}
+
+// PropertyError is returned when parsing an invalid property
+type PropertyError struct {
+	Src string
+	Msg string
+}
+
+func (e PropertyError) Error() string {
+	return fmt.Sprintf("Invalid property '%s': %s", e.Src, e.Msg)
+}
+
+func tokenize(src string) ([]string, error) {
+	tokens := make([]string, 0)
+	rs := []rune(src)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			j := i
+			for j < len(rs) && (rs[j] == '_' || unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j])) {
+				j++
+			}
+			tokens = append(tokens, string(rs[i:j]))
+			i = j
+		case strings.ContainsRune("(),!", r):
+			tokens = append(tokens, string(r))
+			i++
+		case i+1 < len(rs) && (string(rs[i:i+2]) == "&&" || string(rs[i:i+2]) == "||" ||
+			string(rs[i:i+2]) == "->"):
+			tokens = append(tokens, string(rs[i:i+2]))
+			i += 2
+		default:
+			return nil, PropertyError{Src: src, Msg: fmt.Sprintf("unexpected '%c'", r)}
+		}
+	}
+	return tokens, nil
+}
+
+type propertyParser struct {
+	src    string
+	tokens []string
+	p      *proto.Protocol
+}
+
+func (ps *propertyParser) errorf(format string, args ...interface{}) error {
+	return PropertyError{Src: ps.src, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (ps *propertyParser) peek() string {
+	if len(ps.tokens) == 0 {
+		return ""
+	}
+	return ps.tokens[0]
+}
+
+func (ps *propertyParser) next() string {
+	t := ps.peek()
+	if len(ps.tokens) > 0 {
+		ps.tokens = ps.tokens[1:]
+	}
+	return t
+}
+
+func (ps *propertyParser) expect(t string) error {
+	if found := ps.next(); found != t {
+		return ps.errorf("expected '%s', found '%s'", t, found)
+	}
+	return nil
+}
+
+func (ps *propertyParser) expr() (Predicate, error) {
+	left, err := ps.or()
+	if err != nil || ps.peek() != "->" {
+		return left, err
+	}
+	ps.next()
+	right, err := ps.expr()
+	if err != nil {
+		return nil, err
+	}
+	return func(s State) bool { return !left(s) || right(s) }, nil
+}
+
+func (ps *propertyParser) or() (Predicate, error) {
+	left, err := ps.and()
+	for err == nil && ps.peek() == "||" {
+		ps.next()
+		var right Predicate
+		if right, err = ps.and(); err == nil {
+			l := left
+			left = func(s State) bool { return l(s) || right(s) }
+		}
+	}
+	return left, err
+}
+
+func (ps *propertyParser) and() (Predicate, error) {
+	left, err := ps.unary()
+	for err == nil && ps.peek() == "&&" {
+		ps.next()
+		var right Predicate
+		if right, err = ps.unary(); err == nil {
+			l := left
+			left = func(s State) bool { return l(s) && right(s) }
+		}
+	}
+	return left, err
+}
+
+func (ps *propertyParser) unary() (Predicate, error) {
+	switch ps.peek() {
+	case "!":
+		ps.next()
+		pred, err := ps.unary()
+		if err != nil {
+			return nil, err
+		}
+		return not(pred), nil
+	case "(":
+		ps.next()
+		pred, err := ps.expr()
+		if err != nil {
+			return nil, err
+		}
+		return pred, ps.expect(")")
+	}
+	return ps.atom()
+}
+
+func (ps *propertyParser) atom() (Predicate, error) {
+	switch name := ps.next(); name {
+	case "true":
+		return func(State) bool { return true }, nil
+	case "false":
+		return func(State) bool { return false }, nil
+	case "complete":
+		return State.Complete, nil
+	case "sent", "received", "bound":
+		args, err := ps.args(1)
+		if err != nil {
+			return nil, err
+		}
+		if name == "bound" {
+			err = ps.checkParam(args[0])
+		} else {
+			err = ps.checkAction(args[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "sent":
+			return func(s State) bool { return s.Sent(args[0]) }, nil
+		case "received":
+			return func(s State) bool { return s.Received(args[0]) }, nil
+		}
+		return func(s State) bool { return s.Bound(args[0]) }, nil
+	case "knows":
+		args, err := ps.args(2)
+		if err != nil {
+			return nil, err
+		}
+		if err := ps.checkRole(args[0]); err != nil {
+			return nil, err
+		}
+		if err := ps.checkParam(args[1]); err != nil {
+			return nil, err
+		}
+		return func(s State) bool { return s.Knows(proto.Role(args[0]), args[1]) }, nil
+	case "":
+		return nil, ps.errorf("unexpected end")
+	default:
+		return nil, ps.errorf("unknown atom '%s'", name)
+	}
+}
+
+// args parses a parenthesized list of n names
+func (ps *propertyParser) args(n int) ([]string, error) {
+	if err := ps.expect("("); err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			if err := ps.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg := ps.next()
+		if arg == "" || strings.ContainsAny(arg, "(),!&|-") {
+			return nil, ps.errorf("expected a name, found '%s'", arg)
+		}
+		args = append(args, arg)
+	}
+	return args, ps.expect(")")
+}
+
+func (ps *propertyParser) checkAction(name string) error {
+	for _, a := range ps.p.Actions {
+		if a.Name == name {
+			return nil
+		}
+	}
+	return ps.errorf("unknown action '%s'", name)
+}
+
+func (ps *propertyParser) checkRole(name string) error {
+	for _, r := range ps.p.Roles {
+		if string(r) == name {
+			return nil
+		}
+	}
+	return ps.errorf("unknown role '%s'", name)
+}
+
+// checkParam accepts the parameters of the protocol and of its actions
+func (ps *propertyParser) checkParam(name string) error {
+	if _, found := ps.p.Param(name); found {
+		return nil
+	}
+	for _, a := range ps.p.Actions {
+		for _, param := range a.Params {
+			if param.Name == name {
+				return nil
+			}
+		}
+	}
+	return ps.errorf("unknown parameter '%s'", name)
+}
+
+func not(pred Predicate) Predicate {
+	return func(s State) bool { return !pred(s) }
+}
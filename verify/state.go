@@ -0,0 +1,262 @@
+package verify
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+// inputSource is the source of the bindings of the 'in' parameters of the
+// protocol, known by every role from the start
+const inputSource = "<in>"
+
+// view of a role: the parameters it knows mapped to the action that
+// bound them
+type view map[string]string
+
+func (v view) copy() view {
+	c := make(view, len(v))
+	for k, x := range v {
+		c[k] = x
+	}
+	return c
+}
+
+// State of an enactment in the knowledge-state space: what each role
+// knows and which messages have been sent and received
+type State struct {
+	p     *proto.Protocol
+	views map[proto.Role]view
+	// payloads of the sent messages by action index
+	sent     map[int]view
+	received map[int]bool
+}
+
+func initialState(p *proto.Protocol) State {
+	s := State{
+		p:        p,
+		views:    make(map[proto.Role]view, len(p.Roles)),
+		sent:     make(map[int]view),
+		received: make(map[int]bool),
+	}
+	for _, r := range p.Roles {
+		v := make(view)
+		for _, in := range p.Ins() {
+			v[in.Name] = inputSource
+		}
+		s.views[r] = v
+	}
+	return s
+}
+
+// Sent returns true if an action with the name has been sent
+func (s State) Sent(action string) bool {
+	for j := range s.sent {
+		if s.p.Actions[j].Name == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Received returns true if an action with the name has been received
+func (s State) Received(action string) bool {
+	for j := range s.received {
+		if s.p.Actions[j].Name == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Knows returns true if a role knows the binding of a parameter
+func (s State) Knows(r proto.Role, param string) bool {
+	_, found := s.views[r][param]
+	return found
+}
+
+// Bound returns true if any role knows the binding of a parameter
+func (s State) Bound(param string) bool {
+	for _, v := range s.views {
+		if _, found := v[param]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// InFlight returns the names of the sent messages that haven't been
+// received, sorted
+func (s State) InFlight() []string {
+	names := make([]string, 0)
+	for j := range s.sent {
+		if !s.received[j] {
+			names = append(names, s.p.Actions[j].Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Complete returns true if every 'out' parameter of the protocol is known
+// by some role
+func (s State) Complete() bool {
+	for _, out := range s.p.Outs() {
+		if !s.Bound(out.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// Terminal returns true if no message can be sent or received
+func (s State) Terminal() bool {
+	return len(s.InFlight()) == 0 && len(s.sendable()) == 0
+}
+
+// Consistent returns true if the roles and the messages agree on the
+// action that bound each parameter
+func (s State) Consistent() bool {
+	sources := make(map[string]string)
+	check := func(v view) bool {
+		for param, source := range v {
+			if known, found := sources[param]; found && known != source {
+				return false
+			}
+			sources[param] = source
+		}
+		return true
+	}
+	for _, r := range s.p.Roles {
+		if !check(s.views[r]) {
+			return false
+		}
+	}
+	for _, payload := range s.sent {
+		if !check(payload) {
+			return false
+		}
+	}
+	return true
+}
+
+// sendable returns the indexes of the actions whose sender knows their
+// 'in' parameters and none of their 'out' and 'nil' parameters. Each
+// action is sent at most once.
+func (s State) sendable() []int {
+	enabled := make([]int, 0)
+	for j, a := range s.p.Actions {
+		if _, sent := s.sent[j]; sent {
+			continue
+		}
+		v := s.views[a.From]
+		ok := true
+		for _, param := range a.Params {
+			_, known := v[param.Name]
+			if known != (param.Io == proto.In) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			enabled = append(enabled, j)
+		}
+	}
+	return enabled
+}
+
+// send returns the state after the sender of an action binds its 'out'
+// parameters and sends it
+func (s State) send(j int) State {
+	a := s.p.Actions[j]
+	next := s.copy()
+	v := next.views[a.From].copy()
+	payload := make(view, len(a.Params))
+	for _, param := range a.Params {
+		switch param.Io {
+		case proto.In:
+			payload[param.Name] = v[param.Name]
+		case proto.Out:
+			v[param.Name] = a.Name
+			payload[param.Name] = a.Name
+		}
+	}
+	next.views[a.From] = v
+	next.sent[j] = payload
+	return next
+}
+
+// receive returns the state after the recipient of a message learns its
+// bindings. Known bindings are kept.
+func (s State) receive(j int) State {
+	a := s.p.Actions[j]
+	next := s.copy()
+	v := next.views[a.To].copy()
+	for param, source := range s.sent[j] {
+		if _, known := v[param]; !known {
+			v[param] = source
+		}
+	}
+	next.views[a.To] = v
+	next.received[j] = true
+	return next
+}
+
+// copy the state, views are copied when they change
+func (s State) copy() State {
+	c := State{
+		p:        s.p,
+		views:    make(map[proto.Role]view, len(s.views)),
+		sent:     make(map[int]view, len(s.sent)+1),
+		received: make(map[int]bool, len(s.received)+1),
+	}
+	for r, v := range s.views {
+		c.views[r] = v
+	}
+	for j, payload := range s.sent {
+		c.sent[j] = payload
+	}
+	for j := range s.received {
+		c.received[j] = true
+	}
+	return c
+}
+
+// hash of the canonical encoding of the state
+func (s State) hash() uint64 {
+	var sb strings.Builder
+	for _, r := range s.p.Roles {
+		sb.WriteString(string(r) + "{")
+		writeView(&sb, s.views[r])
+		sb.WriteString("}")
+	}
+	for j := range s.p.Actions {
+		if payload, sent := s.sent[j]; sent {
+			sb.WriteString("|" + s.p.Actions[j].Name + "{")
+			writeView(&sb, payload)
+			if s.received[j] {
+				sb.WriteString("}r")
+			} else {
+				sb.WriteString("}s")
+			}
+		} else {
+			sb.WriteString("|-")
+		}
+	}
+	h := fnv.New64a()
+	h.Write([]byte(sb.String()))
+	return h.Sum64()
+}
+
+func writeView(sb *strings.Builder, v view) {
+	params := make([]string, 0, len(v))
+	for param := range v {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	for _, param := range params {
+		sb.WriteString(param + "=" + v[param] + ";")
+	}
+}
@@ -0,0 +1,170 @@
+package verify
+
+import (
+	"testing"
+
+	"github.com/mikelsr/bspl/proto"
+)
+
+func testProtocol() proto.Protocol {
+	buyer := proto.Role("Buyer")
+	seller := proto.Role("Seller")
+	return proto.Protocol{
+		Name:  "Purchase",
+		Roles: []proto.Role{buyer, seller},
+		Params: []proto.Parameter{
+			{Name: "ID", Key: true, Io: proto.Out, Type: proto.Int},
+			{Name: "item", Io: proto.Out},
+			{Name: "price", Io: proto.Out, Type: proto.Decimal},
+			{Name: "decision", Io: proto.Out},
+		},
+		Actions: []proto.Action{
+			{Name: "Request", From: buyer, To: seller, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.Out},
+				{Name: "item", Io: proto.Out},
+			}},
+			{Name: "Offer", From: seller, To: buyer, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "item", Io: proto.In},
+				{Name: "price", Io: proto.Out},
+			}},
+			{Name: "Accept", From: buyer, To: seller, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "price", Io: proto.In},
+				{Name: "decision", Io: proto.Out},
+			}},
+			{Name: "Reject", From: buyer, To: seller, Params: []proto.Parameter{
+				{Name: "ID", Key: true, Io: proto.In},
+				{Name: "price", Io: proto.In},
+				{Name: "decision", Io: proto.Out},
+			}},
+		},
+	}
+}
+
+func parse(t *testing.T, src string) Property {
+	t.Helper()
+	prop, err := ParseProperty(testProtocol(), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prop
+}
+
+func TestCheck(t *testing.T) {
+	props := []Property{
+		Safety(),
+		Liveness(),
+		parse(t, "never sent(Accept) && sent(Reject)"),
+		parse(t, "always received(Offer) -> knows(Buyer, price)"),
+		parse(t, "always knows(Seller, decision) -> (received(Accept) || received(Reject))"),
+		Invariant("one message in flight", func(s State) bool { return len(s.InFlight()) <= 1 }),
+	}
+	r, err := Check(testProtocol(), props, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Holds() || r.Incomplete || r.States == 0 {
+		t.Fatalf("Unexpected report: %+v", r)
+	}
+	for _, res := range r.Results {
+		if !res.Holds || len(res.Counterexample) != 0 {
+			t.Fatalf("Unexpected result: %+v", res)
+		}
+	}
+}
+
+func TestCheck_Counterexample(t *testing.T) {
+	r, err := Check(testProtocol(), []Property{parse(t, "final sent(Accept)")}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := r.Results[0]
+	if r.Holds() || res.Holds || res.Scope != Final {
+		t.Fatalf("Unexpected report: %+v", r)
+	}
+	expected := []string{
+		"Buyer sends Request to Seller",
+		"Seller receives Request from Buyer",
+		"Seller sends Offer to Buyer",
+		"Buyer receives Offer from Seller",
+		"Buyer sends Reject to Seller",
+		"Seller receives Reject from Buyer",
+	}
+	if len(res.Counterexample) != len(expected) {
+		t.Fatalf("Unexpected counterexample: %v", res.Counterexample)
+	}
+	for i, e := range res.Counterexample {
+		if e.String() != expected[i] {
+			t.Fatalf("Expected '%s', found '%s'", expected[i], e)
+		}
+	}
+}
+
+func TestCheck_Safety(t *testing.T) {
+	p := testProtocol()
+	p.Actions = append(p.Actions, proto.Action{Name: "Cancel", From: "Seller", To: "Buyer",
+		Params: []proto.Parameter{
+			{Name: "ID", Key: true, Io: proto.In},
+			{Name: "decision", Io: proto.Out},
+		}})
+	r, err := Check(p, []Property{Safety()}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := r.Results[0]
+	if res.Holds {
+		t.Fatal("Expected the buyer and the seller to bind 'decision' concurrently")
+	}
+	trace := res.Counterexample
+	last := trace[len(trace)-1]
+	if len(trace) != 6 || last.Kind != Send || (last.Action != "Accept" && last.Action != "Cancel") {
+		t.Fatalf("Unexpected counterexample: %v", trace)
+	}
+}
+
+func TestCheck_MaxStates(t *testing.T) {
+	r, err := Check(testProtocol(), []Property{Safety()}, Options{MaxStates: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Incomplete || r.States > 3 {
+		t.Fatalf("Unexpected report: %+v", r)
+	}
+}
+
+func TestParseProperty(t *testing.T) {
+	invalid := []string{
+		"",
+		"sent(Accept)",
+		"always",
+		"always sent(",
+		"always sent(Accept",
+		"always knows(Buyer)",
+		"always unknown(x)",
+		"always (true",
+		"always true false",
+		"always a % b",
+		// names not in the protocol
+		"never sent(Acept)",
+		"always received(Pay) -> bound(price)",
+		"always bound(cost)",
+		"always knows(Shipper, price)",
+		"always knows(Buyer, cost)",
+	}
+	for _, src := range invalid {
+		if _, err := ParseProperty(testProtocol(), src); err == nil {
+			t.Fatalf("Expected '%s' to be invalid", src)
+		} else if _, ok := err.(PropertyError); !ok {
+			t.Fatalf("Unexpected error type %T", err)
+		}
+	}
+	prop := parse(t, "never !false || false && true")
+	if prop.Scope != Always || prop.Name != "never !false || false && true" {
+		t.Fatalf("Unexpected property: %+v", prop)
+	}
+	s := initialState(&proto.Protocol{})
+	if prop.Holds(s) {
+		t.Fatal("Expected the property to be violated")
+	}
+}